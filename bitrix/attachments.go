@@ -0,0 +1,200 @@
+package bitrix
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+const (
+	requestDialogGet   = "im.dialog.get"
+	requestDiskFolder  = "im.disk.folder.get"
+	requestDiskUpload  = "disk.folder.uploadfile"
+	requestDiskCommit  = "im.disk.file.commit"
+	reqValueUploadId   = "UPLOAD_ID"
+	defaultAttachLimit = 4 << 10
+	attachColor        = "#c2c2c2"
+)
+
+type file struct {
+	name        string
+	contentType string
+	content     []byte
+}
+
+// text reports whether the file is a small text, like a log excerpt,
+// which is shown right in the message as an ATTACH block.
+func (f file) text(limit int) bool {
+	if len(f.content) > limit || !utf8.Valid(f.content) {
+		return false
+	}
+	return strings.HasPrefix(f.contentType, "text/") || f.contentType == "application/json"
+}
+
+func readFiles(attachments []notification.Attachment) ([]file, error) {
+	var files []file
+	for i, a := range attachments {
+		if a.Content == nil {
+			continue
+		}
+		content, err := io.ReadAll(a.Content)
+		if err != nil {
+			return nil, err
+		}
+		f := file{
+			name:        a.Filename,
+			contentType: a.ContentType,
+			content:     content,
+		}
+		if f.name == "" {
+			f.name = fmt.Sprintf("file%d", i+1)
+		}
+		if f.contentType == "" {
+			f.contentType = mime.TypeByExtension(filepath.Ext(f.name))
+		}
+		if f.contentType == "" {
+			f.contentType = http.DetectContentType(content)
+		}
+		if mediaType, _, err := mime.ParseMediaType(f.contentType); err == nil {
+			f.contentType = mediaType
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// splitFiles separates the files shown as ATTACH blocks from the ones uploaded to the disk.
+func (n *Notificator) splitFiles(files []file) (inline, upload []file) {
+	limit := n.cfg.AttachLimit
+	if limit <= 0 {
+		limit = defaultAttachLimit
+	}
+	for _, f := range files {
+		if f.text(limit) {
+			inline = append(inline, f)
+		} else {
+			upload = append(upload, f)
+		}
+	}
+	return inline, upload
+}
+
+// attachBlocks renders the files as the ATTACH parameter of a message:
+// the file name in bold followed by its content.
+func attachBlocks(files []file) map[string]interface{} {
+	var blocks []map[string]interface{}
+	for i, f := range files {
+		if i > 0 {
+			blocks = append(blocks, map[string]interface{}{
+				"DELIMITER": map[string]interface{}{"SIZE": 200, "COLOR": attachColor},
+			})
+		}
+		blocks = append(blocks,
+			map[string]interface{}{"MESSAGE": "[B]" + f.name + "[/B]"},
+			map[string]interface{}{"MESSAGE": string(f.content)},
+		)
+	}
+	return map[string]interface{}{
+		"COLOR":  attachColor,
+		"BLOCKS": blocks,
+	}
+}
+
+// uploadFiles uploads the files to the disk folder of the dialog and
+// posts them to the chat.
+func (n *Notificator) uploadFiles(ctx context.Context, dialogId string, files []file) error {
+	chatId, err := n.chatID(ctx, dialogId)
+	if err != nil {
+		return err
+	}
+	res, err := n.post(ctx, n.requestPath(requestDiskFolder), map[string]interface{}{
+		reqValueChatId: chatId,
+	})
+	if err != nil {
+		return err
+	}
+	if err := res.err(); err != nil {
+		return err
+	}
+	folderId := resultField(res.Result, reqValueID)
+	if folderId == "" {
+		return fmt.Errorf("%s: no folder id in response", requestDiskFolder)
+	}
+
+	for _, f := range files {
+		res, err := n.post(ctx, n.requestPath(requestDiskUpload), map[string]interface{}{
+			"id":                 folderId,
+			"data":               map[string]string{"NAME": f.name},
+			"fileContent":        []string{f.name, base64.StdEncoding.EncodeToString(f.content)},
+			"generateUniqueName": true,
+		})
+		if err != nil {
+			return fmt.Errorf("upload %s: %w", f.name, err)
+		}
+		if err := res.err(); err != nil {
+			return fmt.Errorf("upload %s: %w", f.name, err)
+		}
+		fileId := resultField(res.Result, reqValueID)
+		if fileId == "" {
+			return fmt.Errorf("upload %s: no file id in response", f.name)
+		}
+
+		res, err = n.post(ctx, n.requestPath(requestDiskCommit), map[string]interface{}{
+			reqValueChatId:   chatId,
+			reqValueUploadId: fileId,
+		})
+		if err != nil {
+			return fmt.Errorf("commit %s: %w", f.name, err)
+		}
+		if err := res.err(); err != nil {
+			return fmt.Errorf("commit %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// chatID returns the chat id of the dialog: "chat123" is the chat 123,
+// for a user id the chat is asked from the portal.
+func (n *Notificator) chatID(ctx context.Context, dialogId string) (string, error) {
+	if id, ok := strings.CutPrefix(dialogId, "chat"); ok {
+		return id, nil
+	}
+	res, err := n.post(ctx, n.requestPath(requestDialogGet), map[string]interface{}{
+		reqValueDialog: dialogId,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := res.err(); err != nil {
+		return "", err
+	}
+	id := resultField(res.Result, "id")
+	if id == "" {
+		return "", fmt.Errorf("%s: no chat id for dialog %s", requestDialogGet, dialogId)
+	}
+	return id, nil
+}
+
+// resultField returns the id-like field of an object result as a string.
+func resultField(result interface{}, key string) string {
+	fields, ok := result.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	switch v := fields[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
@@ -1,15 +1,25 @@
 package bitrix
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	neturl "net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"redits.oculeus.com/asorokin/notification"
+	"redits.oculeus.com/asorokin/notification/ratelimit"
+	"redits.oculeus.com/asorokin/notification/render"
+	"redits.oculeus.com/asorokin/notification/tracing"
 	"redits.oculeus.com/asorokin/request"
 )
 
@@ -33,15 +43,32 @@ const (
 	reqValueClientId        = "CLIENT_ID"
 	reqValueComplete        = "COMPLETE"
 	reqValueID              = "ID"
-	// reqValueAttach  = "ATTACH"
+	reqValueAttach          = "ATTACH"
 )
 
+const Name = "bitrix"
+
+func init() {
+	notification.Register(Name, func(decode func(interface{}) error, opts ...notification.Option) (notification.Notificator, error) {
+		cfg := &Config{}
+		if err := decode(cfg); err != nil {
+			return nil, err
+		}
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		return New(cfg, opts...), nil
+	})
+}
+
 type Notificator struct {
-	cfg *Config
+	cfg     *Config
+	limiter *ratelimit.Limiter
+	log     *slog.Logger
 }
 
 func (n *Notificator) String() string {
-	return "bitrix"
+	return Name
 }
 
 type Config struct {
@@ -57,14 +84,67 @@ type Config struct {
 	Timeout         time.Duration `cfg:"timeout"`
 	LifetimeMessage time.Duration `cfg:"lifetime_message"`
 	UseNotification bool          `cfg:"use_notification"`
+	AttachLimit     int           `cfg:"attach_limit"`
+	// NotifySeverity is the lowest severity of the messages sent as
+	// notifications too, all by default. Critical messages are always
+	// sent as notifications when the admin is set.
+	NotifySeverity notification.Severity `cfg:"notify_severity"`
+	// RateLimit limits the REST calls to the portal, the address limit is per chat.
+	RateLimit ratelimit.Config `cfg:"rate_limit"`
 	// Addresses       []string      `cfg:"addresses"`
 }
 
-func New(cfg *Config) *Notificator {
+func (c *Config) Validate() error {
+	var missing []string
+	if c.Host == "" {
+		missing = append(missing, "host")
+	}
+	if c.UserID == "" {
+		missing = append(missing, "user_id")
+	}
+	if c.UserToken == "" {
+		missing = append(missing, "user_token")
+	}
+	if c.BotID == "" {
+		missing = append(missing, "bot_id")
+	}
+	if c.ClientID == "" {
+		missing = append(missing, "client_id")
+	}
+	if c.UseNotification {
+		if c.AdminID == "" {
+			missing = append(missing, "admin_id")
+		}
+		if c.AdminToken == "" {
+			missing = append(missing, "admin_token")
+		}
+	}
+	return notification.MissingFields(Name, missing...)
+}
+
+func New(cfg *Config, opts ...notification.Option) *Notificator {
 	if cfg.Proto == "" {
 		cfg.Proto = bitrixProtocol
 	}
-	return &Notificator{cfg}
+	o := notification.NewOptions(opts...)
+	return &Notificator{
+		cfg:     cfg,
+		limiter: ratelimit.NewLimiter(cfg.RateLimit),
+		log:     o.Logger.With(notification.LogChannel, Name),
+	}
+}
+
+// redact hides the tokens in the URLs of the HTTP client errors.
+func (n *Notificator) redact(err error) string {
+	return notification.Redact(err.Error(), n.cfg.UserToken, n.cfg.AdminToken, n.cfg.ClientID)
+}
+
+// notify reports whether the message of the severity is sent as a system notification too.
+func (n *Notificator) notify(severity notification.Severity) bool {
+	if n.cfg.UseNotification && severity.AtLeast(n.cfg.NotifySeverity) {
+		return true
+	}
+	return severity == notification.SeverityCritical && n.cfg.AdminID != "" && n.cfg.AdminToken != ""
 }
 
 func (n *Notificator) requestPath(request string) string {
@@ -132,24 +212,36 @@ func MethodApiURL(m *MethodApi) string {
 }
 */
 
-func (n *Notificator) urlForMessage(dialogId, message string) string {
+func (n *Notificator) urlForPath(path string) string {
 	return request.NewAddress(n.cfg.Proto, n.cfg.Host).
-		SetEndpoint(
-			n.requestPath(requestMessage),
-			reqValueSystem, "Y",
-			reqValueDialog, dialogId,
-			reqValueMessage, message,
-		)
+		SetEndpoint(path)
 }
 
-func (n *Notificator) urlForBotMessage(dialogId, message string) string {
+// botMessageParams are the params of imbot.message.add, sent in a POST body:
+// a long message doesn't fit into the URL and must not get into access logs.
+func (n *Notificator) botMessageParams(dialogId, message string) map[string]interface{} {
+	return map[string]interface{}{
+		reqValueDialog:   dialogId,
+		reqValueMessage:  message,
+		reqValueBotId:    n.cfg.BotID,
+		reqValueClientId: n.cfg.ClientID,
+	}
+}
+
+func (n *Notificator) notifyParams(userId, message string) map[string]interface{} {
+	return map[string]interface{}{
+		reqValueUserId:  userId,
+		reqValueMessage: message,
+	}
+}
+
+func (n *Notificator) urlForMessage(dialogId, message string) string {
 	return request.NewAddress(n.cfg.Proto, n.cfg.Host).
 		SetEndpoint(
-			n.requestPath(requestBotMessage),
+			n.requestPath(requestMessage),
+			reqValueSystem, "Y",
 			reqValueDialog, dialogId,
 			reqValueMessage, message,
-			reqValueBotId, n.cfg.BotID,
-			reqValueClientId, n.cfg.ClientID,
 		)
 }
 
@@ -199,19 +291,15 @@ func (n *Notificator) urlForBotUserList(chatId string) string {
 		)
 }
 
-func (n *Notificator) getUserListForNotificate(chats []string) []string {
+func (n *Notificator) getUserListForNotificate(ctx context.Context, chats []string) []string {
 	//TODO: переделать под универсальный ответ
 	var users []string
 	for _, chat := range chats {
 		if strings.HasPrefix(chat, "chat") {
 			ids := func() []int64 {
-				res, err := request.Do(&request.Params{
-					URL: n.urlForBotUserList(chat),
-					Client: &http.Client{
-						Timeout: n.cfg.Timeout,
-					},
-				})
+				res, err := n.do(ctx, n.urlForBotUserList(chat))
 				if err != nil {
+					n.log.WarnContext(ctx, "chat user list failed", notification.LogAddress, chat, notification.LogError, n.redact(err))
 					return nil
 				}
 				defer res.Body.Close()
@@ -228,6 +316,7 @@ func (n *Notificator) getUserListForNotificate(chats []string) []string {
 					} `json:"time"`
 				}
 				if res.StatusCode != 200 {
+					n.log.WarnContext(ctx, "chat user list failed", notification.LogAddress, chat, "status", res.Status)
 					return nil
 				}
 				if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
@@ -250,20 +339,46 @@ func (n *Notificator) getUserListForNotificate(chats []string) []string {
 }
 
 func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
 
-	if len(message.Addresses) == 0 {
-		return errors.New("no addresses to send")
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	res, err := n.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
 	}
+	return res.Err()
+}
+
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	ctx, span := tracing.Start(ctx, Name, Name+" send",
+		tracing.RecipientsKey.Int(len(message.Addresses)),
+		tracing.AttachmentsKey.Int(len(attachments)),
+	)
+	res, err := n.deliver(ctx, message, attachments...)
+	tracing.EndResult(span, res, err)
+	return res, err
+}
 
-	//TODO: implement attacments for Bitrix
+func (n *Notificator) deliver(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
 
-	if n.cfg.UseNotification {
-		for _, u := range n.getUserListForNotificate(message.Addresses) {
-			//TODO: в рутинах и без чтения ошибок
+	if len(message.Addresses) == 0 {
+		return nil, notification.ErrNoAddresses
+	}
+
+	if n.notify(message.Severity) {
+		// notifications outlive the call, so they keep the context values only
+		bg := context.WithoutCancel(ctx)
+		for _, u := range n.getUserListForNotificate(ctx, message.Addresses) {
 			user := u
 			go func() {
-				url := n.urlForNotify(user, message.Subject)
-				n.send(url)
+				res, err := n.post(bg, n.requestPathAdmin(requestNotify), n.notifyParams(user, message.Subject))
+				if err == nil {
+					err = res.err()
+				}
+				if err != nil {
+					n.log.ErrorContext(bg, "notify failed", notification.LogAddress, user, notification.LogError, n.redact(err))
+				}
 			}()
 			// if _, err := n.send(url); err != nil {
 			// 	return err
@@ -273,34 +388,83 @@ func (n *Notificator) SendMessage(message notification.Message, attachments ...n
 
 	body, err := io.ReadAll(message.Content)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	files, err := readFiles(attachments)
+	if err != nil {
+		return nil, err
 	}
+	inline, upload := n.splitFiles(files)
+	text := string(body)
+	if message.Format != notification.FormatDefault {
+		text = render.BBCode(text, message.Format)
+	}
+
+	result := &notification.Result{Channel: Name}
 	for _, chat := range message.Addresses {
-		url := n.urlForBotMessage(chat, string(body))
-		res, err := n.send(url)
+		if err := n.limiter.WaitAddress(ctx, chat); err != nil {
+			n.add(ctx, result, chat, "", err)
+			continue
+		}
+		params := n.botMessageParams(chat, text)
+		if len(inline) > 0 {
+			params[reqValueAttach] = attachBlocks(inline)
+		}
+		res, err := n.post(ctx, n.requestPath(requestBotMessage), params)
 		if err != nil {
-			return err // error by DoRequest or decode response json
+			n.add(ctx, result, chat, "", err) // error by DoRequest or decode response json
+			continue
 		}
 
-		if res.StatusCode != 200 {
-			return fmt.Errorf("status: %s error: %s : %s", res.Status, res.Error, res.Description)
+		if err := res.err(); err != nil {
+			n.add(ctx, result, chat, "", err)
+			continue
 		}
 
-		switch result := res.Result.(type) {
-		case int, float64:
+		var messageID string
+		switch id := res.Result.(type) {
+		case float64:
+			messageID = strconv.FormatFloat(id, 'f', -1, 64)
 			if n.cfg.LifetimeMessage > 0 {
+				chat := chat
 				go func() {
 					time.Sleep(n.cfg.LifetimeMessage)
-					n.send(n.urlForBotDeleteMessage(fmt.Sprintf("%v", result)))
+					bg := context.WithoutCancel(ctx)
+					res, err := n.send(bg, n.urlForBotDeleteMessage(messageID))
+					if err == nil {
+						err = res.err()
+					}
+					if err != nil {
+						n.log.ErrorContext(bg, "delete message failed", notification.LogAddress, chat,
+							notification.LogMessageID, messageID, notification.LogError, n.redact(err))
+					}
 				}()
 			}
 			// case bool:
 			//пока не надо никак обрабатывать
 		}
-
+		if len(upload) > 0 {
+			if err := n.uploadFiles(ctx, chat, upload); err != nil {
+				n.add(ctx, result, chat, messageID, fmt.Errorf("attachments: %w", err))
+				continue
+			}
+		}
+		n.add(ctx, result, chat, messageID, nil)
 	}
 
-	return nil
+	return result, nil
+}
+
+// add adds the delivery of the chat to the result and logs it.
+func (n *Notificator) add(ctx context.Context, result *notification.Result, chat, messageID string, err error) {
+	if err != nil {
+		n.log.WarnContext(ctx, "send failed", notification.LogAddress, chat,
+			notification.LogMessageID, messageID, notification.LogError, n.redact(err))
+		err = sendError(chat, err)
+	} else {
+		n.log.DebugContext(ctx, "sent", notification.LogAddress, chat, notification.LogMessageID, messageID)
+	}
+	result.Add(chat, messageID, err)
 }
 
 type (
@@ -321,18 +485,138 @@ type (
 	}
 )
 
-func (n *Notificator) send(url string) (*response, error) {
+func (r *response) err() error {
+	if r.StatusCode == 200 && r.Error == "" {
+		return nil
+	}
+	return &APIError{
+		Status:      r.Status,
+		StatusCode:  r.StatusCode,
+		Code:        r.Error,
+		Description: r.Description,
+	}
+}
 
-	res, err := request.Do(&request.Params{
-		URL: url,
-		Client: &http.Client{
-			Timeout: n.cfg.Timeout,
-		},
-	})
+// sendError makes a *notification.SendError of the error sending to the chat.
+func sendError(chat string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var (
+		code   string
+		kind   error
+		apiErr *APIError
+	)
+	if errors.As(err, &apiErr) {
+		code = apiErr.Code
+		if code == "" {
+			code = strconv.Itoa(apiErr.StatusCode)
+		}
+		switch {
+		case apiErr.Code == "QUERY_LIMIT_EXCEEDED", apiErr.StatusCode == http.StatusTooManyRequests:
+			kind = notification.ErrRateLimited
+		case apiErr.Code == "expired_token", apiErr.Code == "invalid_token", apiErr.Code == "NO_AUTH_FOUND",
+			apiErr.Code == "INVALID_CREDENTIALS", apiErr.StatusCode == http.StatusUnauthorized:
+			kind = notification.ErrUnauthorized
+		case apiErr.Code == "DIALOG_ID_EMPTY", apiErr.Code == "ACCESS_ERROR":
+			kind = notification.ErrInvalidAddress
+		}
+	}
+	return notification.NewSendError(Name, chat, code, kind, err)
+}
+
+// APIError is an error returned by the Bitrix REST API.
+type APIError struct {
+	Status      string
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("status: %s error: %s : %s", e.Status, e.Code, e.Description)
+}
+
+// Temporary reports whether the request may succeed later:
+// the portal query limit or a server error.
+func (e *APIError) Temporary() bool {
+	switch e.Code {
+	case "QUERY_LIMIT_EXCEEDED", "INTERNAL_SERVER_ERROR":
+		return true
+	}
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+func (n *Notificator) do(ctx context.Context, url string) (*http.Response, error) {
+	return n.doRequest(ctx, http.MethodGet, url, nil)
+}
+
+func (n *Notificator) doRequest(ctx context.Context, method, url string, body io.Reader) (res *http.Response, err error) {
+	// the REST method is the last path element, the url itself has the tokens
+	restMethod := url
+	if i := strings.IndexByte(restMethod, '?'); i >= 0 {
+		restMethod = restMethod[:i]
+	}
+	restMethod = restMethod[strings.LastIndexByte(restMethod, '/')+1:]
+	ctx, span := tracing.Start(ctx, Name, Name+" "+restMethod,
+		attribute.String("bitrix.method", restMethod),
+		attribute.String("http.method", method),
+	)
+	defer func() {
+		if res != nil {
+			span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+			n.log.DebugContext(ctx, "api response", "method", restMethod, "status", res.StatusCode)
+		}
+		tracing.End(span, err)
+	}()
+
+	if err := n.limiter.Wait(ctx, ""); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := &http.Client{
+		Timeout: n.cfg.Timeout,
+	}
+	res, err = client.Do(req)
+	// the error has the URL with the tokens
+	var urlErr *neturl.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = notification.Redact(urlErr.URL, n.cfg.UserToken, n.cfg.AdminToken, n.cfg.ClientID)
+	}
+	return res, err
+}
+
+// post calls the REST method by the path with the params in a JSON body.
+func (n *Notificator) post(ctx context.Context, path string, params map[string]interface{}) (*response, error) {
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(params); err != nil {
+		return nil, fmt.Errorf("encode body JSON: %w", err)
+	}
+	res, err := n.doRequest(ctx, http.MethodPost, n.urlForPath(path), buf)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return decodeResponse(res)
+}
+
+func (n *Notificator) send(ctx context.Context, url string) (*response, error) {
+
+	res, err := n.do(ctx, url)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
+	return decodeResponse(res)
+}
+
+func decodeResponse(res *http.Response) (*response, error) {
 
 	result := &response{
 		StatusCode: res.StatusCode,
@@ -340,6 +624,9 @@ func (n *Notificator) send(url string) (*response, error) {
 	}
 
 	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		if res.StatusCode != 200 {
+			return result, result.err()
+		}
 		return result, fmt.Errorf("decode response json: %w", err)
 	}
 
@@ -1,20 +1,25 @@
 package bitrix
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"redits.oculeus.com/asorokin/notification"
 )
 
 func testNotificator() *Notificator {
-	return &Notificator{
-		cfg: &Config{
-			Proto:      bitrixProtocol,
-			Host:       "company-name.bitrix24.eu",
-			UserToken:  "777token666",
-			UserID:     "1234",
-			AdminID:    "4321",
-			AdminToken: "666token777",
-		},
-	}
+	return New(&Config{
+		Proto:      bitrixProtocol,
+		Host:       "company-name.bitrix24.eu",
+		UserToken:  "777token666",
+		UserID:     "1234",
+		AdminID:    "4321",
+		AdminToken: "666token777",
+	})
 }
 func Test_notificator_urlForMessage(t *testing.T) {
 	type args struct {
@@ -104,3 +109,74 @@ func Test_notificator_urlForNotify(t *testing.T) {
 	}
 }
 
+
+func Test_notificator_splitFiles(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       file
+		wantInline bool
+	}{
+		{
+			name:       "Короткий лог в ATTACH",
+			file:       file{name: "error.log", contentType: "text/plain", content: []byte("pq: relation does not exist")},
+			wantInline: true,
+		},
+		{
+			name: "Большой отчёт на диск",
+			file: file{name: "report.csv", contentType: "text/csv", content: make([]byte, defaultAttachLimit+1)},
+		},
+		{
+			name: "Картинка на диск",
+			file: file{name: "chart.png", contentType: "image/png", content: []byte("png")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inline, _ := testNotificator().splitFiles([]file{tt.file})
+			if got := len(inline) == 1; got != tt.wantInline {
+				t.Errorf("notificator.splitFiles() inline = %v, want %v", got, tt.wantInline)
+			}
+		})
+	}
+}
+
+func Test_notificator_SendMessagePost(t *testing.T) {
+	var (
+		gotPath   string
+		gotQuery  string
+		gotParams map[string]interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&gotParams); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"result": 1234567}`))
+	}))
+	defer srv.Close()
+
+	n := testNotificator()
+	n.cfg.Proto = "http"
+	n.cfg.Host = strings.TrimPrefix(srv.URL, "http://")
+	n.cfg.BotID = "171"
+	message := strings.Repeat("pq: relation does not exist\n", 1000)
+	res, err := n.Send(context.Background(), notification.Message{
+		Addresses: []string{"chat987"},
+		Content:   strings.NewReader(message),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err() != nil || res.Deliveries[0].MessageID != "1234567" {
+		t.Errorf("notificator.Send() = %+v", res.Deliveries)
+	}
+	if gotPath != "/rest/1234/777token666/imbot.message.add.json" || gotQuery != "" {
+		t.Errorf("notificator.Send() url = %s?%s", gotPath, gotQuery)
+	}
+	if gotParams["MESSAGE"] != message || gotParams["DIALOG_ID"] != "chat987" || gotParams["BOT_ID"] != "171" {
+		t.Errorf("notificator.Send() params = %v", gotParams)
+	}
+}
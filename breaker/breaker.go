@@ -0,0 +1,220 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"redits.oculeus.com/asorokin/notification"
+	"redits.oculeus.com/asorokin/notification/retry"
+)
+
+const (
+	defaultFailures    = 5
+	defaultOpenTimeout = 30 * time.Second
+	defaultProbes      = 1
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// OpenError is returned for the messages rejected by an open breaker.
+// It is temporary, so retry waits until the breaker lets a probe through.
+type OpenError struct {
+	Channel string
+	Until   time.Time
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: %v until %s", e.Channel, ErrOpen, e.Until.Format(time.RFC3339))
+}
+
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+func (e *OpenError) Temporary() bool {
+	return true
+}
+
+func (e *OpenError) RetryAfter() time.Duration {
+	if d := time.Until(e.Until); d > 0 {
+		return d
+	}
+	return 0
+}
+
+type Config struct {
+	// Failures is the number of failed messages in a row which opens the breaker.
+	Failures int `cfg:"failures"`
+	// OpenTimeout is how long the breaker stays open before the probes.
+	OpenTimeout time.Duration `cfg:"open_timeout"`
+	// Probes is the number of messages let through while half-open;
+	// the first success closes the breaker, a failure opens it again.
+	Probes int `cfg:"probes"`
+	// Fallback gets the messages while the breaker is open,
+	// without it they fail with *OpenError.
+	Fallback notification.Notificator `cfg:"-"`
+	// IsFailure reports whether the error means the backend is unavailable,
+	// by default the errors retry.Classify retries. Other errors, e.g. an
+	// unknown chat, don't count.
+	IsFailure func(err error) bool `cfg:"-"`
+}
+
+// Notificator stops calling the wrapped notificator after consecutive
+// failures and fails fast while open, see State.
+type Notificator struct {
+	next     notification.Notificator
+	cfg      *Config
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+func New(next notification.Notificator, cfg *Config) *Notificator {
+	if cfg.Failures <= 0 {
+		cfg.Failures = defaultFailures
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaultOpenTimeout
+	}
+	if cfg.Probes <= 0 {
+		cfg.Probes = defaultProbes
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool {
+			ok, _ := retry.Classify(err)
+			return ok
+		}
+	}
+	return &Notificator{next: next, cfg: cfg}
+}
+
+func (n *Notificator) String() string {
+	return n.next.String()
+}
+
+// State returns the state of the breaker for health checks.
+func (n *Notificator) State() State {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.state == Open && time.Since(n.openedAt) >= n.cfg.OpenTimeout {
+		return HalfOpen
+	}
+	return n.state
+}
+
+func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	res, err := n.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	if err := n.allow(); err != nil {
+		if n.cfg.Fallback != nil {
+			return notification.Send(ctx, n.cfg.Fallback, message, attachments...)
+		}
+		res := &notification.Result{Channel: n.String()}
+		for _, addr := range message.Addresses {
+			res.Add(addr, "", err)
+		}
+		return res, nil
+	}
+
+	res, err := notification.Send(ctx, n.next, message, attachments...)
+	if ctx.Err() != nil {
+		// the caller gave up, it says nothing about the backend
+		n.record(false, true)
+		return res, err
+	}
+	if err != nil {
+		n.record(n.cfg.IsFailure(err), false)
+		return nil, err
+	}
+	n.record(n.failed(res), false)
+	return res, nil
+}
+
+// failed reports whether every address failed and some of them because
+// the backend is unavailable.
+func (n *Notificator) failed(res *notification.Result) bool {
+	unavailable := false
+	for _, d := range res.Deliveries {
+		if d.OK() {
+			return false
+		}
+		if n.cfg.IsFailure(d.Err) {
+			unavailable = true
+		}
+	}
+	return unavailable
+}
+
+func (n *Notificator) allow() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.state == Open && time.Since(n.openedAt) >= n.cfg.OpenTimeout {
+		n.state, n.probes = HalfOpen, 0
+	}
+	switch n.state {
+	case Open:
+		return &OpenError{Channel: n.String(), Until: n.openedAt.Add(n.cfg.OpenTimeout)}
+	case HalfOpen:
+		if n.probes >= n.cfg.Probes {
+			return &OpenError{Channel: n.String(), Until: time.Now().Add(n.cfg.OpenTimeout)}
+		}
+		n.probes++
+	}
+	return nil
+}
+
+// record counts the result of a call, ignored results only give the probe back.
+func (n *Notificator) record(failure, ignored bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch {
+	case ignored:
+		if n.state == HalfOpen && n.probes > 0 {
+			n.probes--
+		}
+	case !failure:
+		n.state, n.failures = Closed, 0
+	case n.state == HalfOpen:
+		n.state, n.openedAt = Open, time.Now()
+	default:
+		n.failures++
+		if n.failures >= n.cfg.Failures {
+			n.state, n.openedAt, n.failures = Open, time.Now(), 0
+		}
+	}
+}
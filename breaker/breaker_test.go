@@ -0,0 +1,80 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+	"redits.oculeus.com/asorokin/notification/telegram"
+)
+
+func TestNotificator_SendMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	next.EXPECT().String().Return("telegram").AnyTimes()
+
+	unavailable := &telegram.APIError{Code: 502, Description: "Bad Gateway"}
+	results := []error{
+		errors.New("Bad Request: chat not found"), // doesn't count
+		unavailable,
+		unavailable,
+		nil, // the probe
+	}
+	next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Times(len(results)).
+		DoAndReturn(func(_ interface{}, _ notification.Message, _ ...notification.Attachment) error {
+			err := results[0]
+			results = results[1:]
+			return err
+		})
+
+	n := New(next, &Config{Failures: 2, OpenTimeout: 20 * time.Millisecond})
+	msg := notification.Message{Addresses: []string{"1"}}
+	for i := 0; i < 3; i++ {
+		if err := n.SendMessage(msg); err == nil {
+			t.Fatalf("SendMessage() #%d error = nil", i)
+		}
+	}
+	if n.State() != Open {
+		t.Fatalf("State() = %s, want open", n.State())
+	}
+	err := n.SendMessage(msg)
+	var openErr *OpenError
+	if !errors.Is(err, ErrOpen) || !errors.As(err, &openErr) || openErr.RetryAfter() <= 0 {
+		t.Fatalf("SendMessage() error = %v, want *OpenError", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if n.State() != HalfOpen {
+		t.Fatalf("State() = %s, want half-open", n.State())
+	}
+	if err := n.SendMessage(msg); err != nil {
+		t.Fatalf("SendMessage() probe error = %v", err)
+	}
+	if n.State() != Closed {
+		t.Errorf("State() = %s, want closed", n.State())
+	}
+}
+
+func TestNotificator_Fallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	next.EXPECT().String().Return("bitrix").AnyTimes()
+	next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(&telegram.APIError{Code: 500}).Times(1)
+
+	fallback := mock_notification.NewMockNotificator(ctrl)
+	fallback.EXPECT().String().Return("email").AnyTimes()
+	fallback.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+	n := New(next, &Config{Failures: 1, Fallback: fallback})
+	msg := notification.Message{Addresses: []string{"1"}}
+	if err := n.SendMessage(msg); err == nil {
+		t.Fatal("SendMessage() error = nil")
+	}
+	if err := n.SendMessage(msg); err != nil {
+		t.Errorf("SendMessage() error = %v, want sent by the fallback", err)
+	}
+}
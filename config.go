@@ -0,0 +1,286 @@
+package notification
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configTag         = "cfg"
+	middlewareSection = "middleware"
+	routesSection     = "routes"
+	directorySection  = "directory"
+)
+
+type config struct {
+	Notification struct {
+		Enabled  []string             `yaml:"enabled"`
+		Sections map[string]yaml.Node `yaml:",inline"`
+	} `yaml:"notification"`
+}
+
+// LoadFile reads the notification config file, see Load.
+func LoadFile(path string, opts ...Option) ([]Notificator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f, opts...)
+}
+
+// Load parses the `notification:` section of a YAML config and builds
+// the enabled notificators in the order they are listed, wrapped with
+// the `middleware:` section, see MiddlewareConfig.
+// Backends must be registered, usually by importing their packages.
+// The options, e.g. WithLogger, are passed to every backend.
+func Load(r io.Reader, opts ...Option) ([]Notificator, error) {
+	c, err := parseConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	return c.build(opts...)
+}
+
+// LoadRouterFile reads the notification config file, see LoadRouter.
+func LoadRouterFile(path string, opts ...Option) (*Router, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadRouter(f, opts...)
+}
+
+// LoadRouter builds the notificators like Load and a Router over them
+// with the rules of the `routes:` section and the people and groups of
+// the `directory:` section.
+func LoadRouter(r io.Reader, opts ...Option) (*Router, error) {
+	c, err := parseConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	notificators, err := c.build(opts...)
+	if err != nil {
+		return nil, err
+	}
+	var routes []Route
+	if section, ok := c.Notification.Sections[routesSection]; ok {
+		if err := decodeConfig(&section, &routes); err != nil {
+			return nil, fmt.Errorf("notification: %s: %w", routesSection, err)
+		}
+	}
+	router, err := NewRouter(routes, notificators...)
+	if err != nil {
+		return nil, fmt.Errorf("notification: %s: %w", routesSection, err)
+	}
+	if section, ok := c.Notification.Sections[directorySection]; ok {
+		var dc DirectoryConfig
+		if err := decodeConfig(&section, &dc); err != nil {
+			return nil, fmt.Errorf("notification: %s: %w", directorySection, err)
+		}
+		dir, err := NewDirectory(&dc)
+		if err != nil {
+			return nil, fmt.Errorf("notification: %w", err)
+		}
+		router.WithDirectory(dir)
+	}
+	return router, nil
+}
+
+func parseConfig(r io.Reader) (*config, error) {
+	var c config
+	if err := yaml.NewDecoder(r).Decode(&c); err != nil {
+		return nil, fmt.Errorf("notification: parse config: %w", err)
+	}
+	return &c, nil
+}
+
+func (c *config) build(opts ...Option) ([]Notificator, error) {
+	if len(c.Notification.Enabled) == 0 {
+		return nil, errors.New("notification: no enabled notificators")
+	}
+
+	var mc MiddlewareConfig
+	if section, ok := c.Notification.Sections[middlewareSection]; ok {
+		if err := decodeConfig(&section, &mc); err != nil {
+			return nil, fmt.Errorf("notification: %s: %w", middlewareSection, err)
+		}
+		for channel := range mc.Rewrite {
+			if !slices.Contains(c.Notification.Enabled, channel) {
+				return nil, fmt.Errorf("notification: %s: rewrite %q: %w", middlewareSection, channel, ErrUnknownChannel)
+			}
+		}
+	}
+
+	notificators := make([]Notificator, 0, len(c.Notification.Enabled))
+	for _, name := range c.Notification.Enabled {
+		build, ok := factory(name)
+		if !ok {
+			return nil, fmt.Errorf("notification: unknown notificator %q (registered: %s)",
+				name, strings.Join(Registered(), ", "))
+		}
+		section, ok := c.Notification.Sections[name]
+		decode := func(cfg interface{}) error {
+			if !ok {
+				return nil
+			}
+			return decodeConfig(&section, cfg)
+		}
+		n, err := build(decode, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("notification: %s: %w", name, err)
+		}
+		middlewares, err := mc.Middlewares(name)
+		if err != nil {
+			return nil, fmt.Errorf("notification: %s: %w", middlewareSection, err)
+		}
+		notificators = append(notificators, Chain(n, middlewares...))
+	}
+	return notificators, nil
+}
+
+// decodeConfig fills the struct pointed to by v from a YAML mapping node
+// using the `cfg` tags, so backend configs don't need yaml tags.
+func decodeConfig(node *yaml.Node, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("decode config: non-pointer %T", v)
+	}
+	return decodeValue(node, rv.Elem())
+}
+
+func decodeStruct(node *yaml.Node, rv reflect.Value) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected mapping", node.Line)
+	}
+	fields := make(map[string]reflect.Value)
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		tag := strings.Split(rt.Field(i).Tag.Get(configTag), ",")[0]
+		if tag == "" || tag == "-" || !rt.Field(i).IsExported() {
+			continue
+		}
+		fields[tag] = rv.Field(i)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		field, ok := fields[key.Value]
+		if !ok {
+			return fmt.Errorf("line %d: unknown field %q", key.Line, key.Value)
+		}
+		if err := decodeValue(value, field); err != nil {
+			return fmt.Errorf("%s: %w", key.Value, err)
+		}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func decodeValue(node *yaml.Node, rv reflect.Value) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return nil
+	}
+	if u, ok := rv.Addr().Interface().(encoding.TextUnmarshaler); ok && rv.Kind() != reflect.Ptr {
+		if node.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d: expected scalar", node.Line)
+		}
+		if err := u.UnmarshalText([]byte(node.Value)); err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return decodeValue(node, rv.Elem())
+	case reflect.Struct:
+		return decodeStruct(node, rv)
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return fmt.Errorf("line %d: expected sequence", node.Line)
+		}
+		s := reflect.MakeSlice(rv.Type(), len(node.Content), len(node.Content))
+		for i, item := range node.Content {
+			if err := decodeValue(item, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		rv.Set(s)
+		return nil
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode || rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("line %d: expected mapping", node.Line)
+		}
+		m := reflect.MakeMap(rv.Type())
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			item := reflect.New(rv.Type().Elem()).Elem()
+			if err := decodeValue(node.Content[i+1], item); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(node.Content[i].Value).Convert(rv.Type().Key()), item)
+		}
+		rv.Set(m)
+		return nil
+	}
+
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: expected scalar", node.Line)
+	}
+	s := node.Value
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Type() == durationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", node.Line, err)
+			}
+			rv.SetInt(int64(d))
+			return nil
+		}
+		i, err := strconv.ParseInt(s, 0, rv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 0, rv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		rv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, rv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		rv.SetFloat(f)
+	default:
+		return fmt.Errorf("line %d: unsupported type %s", node.Line, rv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package notification_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"redits.oculeus.com/asorokin/notification"
+	_ "redits.oculeus.com/asorokin/notification/bitrix"
+	_ "redits.oculeus.com/asorokin/notification/email"
+	_ "redits.oculeus.com/asorokin/notification/telegram"
+)
+
+func TestLoadFile(t *testing.T) {
+	got, err := notification.LoadFile("notification.yaml")
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	want := []string{"email", "bitrix", "telegram"}
+	if len(got) != len(want) {
+		t.Fatalf("LoadFile() got %d notificators, want %d", len(got), len(want))
+	}
+	for i, n := range got {
+		if n.String() != want[i] {
+			t.Errorf("LoadFile()[%d] = %v, want %v", i, n, want[i])
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "Только телеграм",
+			config: `
+notification:
+  enabled: [telegram]
+  telegram:
+    host    : api.telegram.org
+    token   : number:token
+    timeout : 5s
+`,
+		},
+		{
+			name: "Перенаправление для выключенного канала",
+			config: `
+notification:
+  enabled: [telegram]
+  telegram:
+    host    : api.telegram.org
+    token   : number:token
+  middleware:
+    rewrite:
+      email:
+        "*" : [qa@mail.xyz]
+`,
+			wantErr: `rewrite "email": unknown channel`,
+		},
+		{
+			name: "Неизвестный нотификатор",
+			config: `
+notification:
+  enabled: [slack]
+`,
+			wantErr: `unknown notificator "slack"`,
+		},
+		{
+			name: "Не заполнены обязательные поля",
+			config: `
+notification:
+  enabled: [email]
+  email:
+    smtp_host : smtp.mail.xyz
+`,
+			wantErr: "missing required fields: smtp_port, smtp_user, smtp_pass",
+		},
+		{
+			name: "Неизвестное поле",
+			config: `
+notification:
+  enabled: [telegram]
+  telegram:
+    host  : api.telegram.org
+    tokken: number:token
+`,
+			wantErr: `unknown field "tokken"`,
+		},
+		{
+			name: "Неверная длительность",
+			config: `
+notification:
+  enabled: [telegram]
+  telegram:
+    host    : api.telegram.org
+    token   : number:token
+    timeout : five
+`,
+			wantErr: "timeout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := notification.Load(strings.NewReader(tt.config))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Load() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_ConfigError(t *testing.T) {
+	config := `
+notification:
+  enabled: [bitrix]
+  bitrix:
+    host: company.bitrix24.eu
+    use_notification: true
+`
+	_, err := notification.Load(strings.NewReader(config))
+	var cfgErr *notification.ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("Load() error = %v, want *ConfigError", err)
+	}
+	if cfgErr.Notificator != "bitrix" || len(cfgErr.Fields) != 6 {
+		t.Errorf("Load() error = %+v", cfgErr)
+	}
+}
+
+func TestLoadRouter(t *testing.T) {
+	router, err := notification.LoadRouter(strings.NewReader(`
+notification:
+  enabled: [telegram]
+  telegram:
+    host  : api.telegram.org
+    token : number:token
+  routes:
+    - severity : error
+      labels   : {team: billing}
+      to       : [telegram:100]
+`))
+	if err != nil {
+		t.Fatalf("LoadRouter() error = %v", err)
+	}
+	got := router.Route(notification.Message{
+		Severity: notification.SeverityCritical,
+		Labels:   map[string]string{"team": "billing"},
+	})
+	if len(got.Addresses) != 1 || got.Addresses[0] != "telegram:100" {
+		t.Errorf("Route() addresses = %v, want [telegram:100]", got.Addresses)
+	}
+
+	_, err = notification.LoadRouter(strings.NewReader(`
+notification:
+  enabled: [telegram]
+  telegram:
+    host  : api.telegram.org
+    token : number:token
+  routes:
+    - severity : fatal
+`))
+	if err == nil || !strings.Contains(err.Error(), `unknown severity "fatal"`) {
+		t.Errorf("LoadRouter() error = %v, want unknown severity", err)
+	}
+}
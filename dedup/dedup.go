@@ -0,0 +1,252 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+const (
+	defaultWindow         = time.Minute
+	defaultSummaryTimeout = 30 * time.Second
+)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+type Config struct {
+	// Window is how long the duplicates of a sent message are suppressed.
+	Window time.Duration `cfg:"window"`
+	// Ignore are regular expressions removed from the content before it's
+	// fingerprinted, e.g. timestamps or request ids.
+	Ignore []string `cfg:"ignore"`
+	// WithoutSubject fingerprints the content only.
+	WithoutSubject bool `cfg:"without_subject"`
+	// Fingerprint replaces the default fingerprint of subject and normalized content.
+	Fingerprint func(message notification.Message, content string) string `cfg:"-"`
+	// OnError is called with the errors of the summaries sent in the background.
+	OnError func(err error) `cfg:"-"`
+}
+
+// Notificator sends the first of equal messages and suppresses the others
+// for the window; when the window closes a "repeated N times since T"
+// summary is sent if anything was suppressed. The messages are compared
+// by their content, so wrap a notificator which gets rendered templates.
+type Notificator struct {
+	next    notification.Notificator
+	cfg     *Config
+	ignore  []*regexp.Regexp
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+type window struct {
+	message notification.Message
+	content []byte
+	since   time.Time
+	count   int
+	timer   *time.Timer
+}
+
+func New(next notification.Notificator, cfg *Config) (*Notificator, error) {
+	if cfg.Window <= 0 {
+		cfg.Window = defaultWindow
+	}
+	n := &Notificator{
+		next:    next,
+		cfg:     cfg,
+		windows: make(map[string]*window),
+	}
+	for _, expr := range cfg.Ignore {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("dedup ignore %q: %w", expr, err)
+		}
+		n.ignore = append(n.ignore, re)
+	}
+	return n, nil
+}
+
+func (n *Notificator) String() string {
+	return n.next.String()
+}
+
+func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	message, key, w, err := n.check(message)
+	if err != nil || w == nil {
+		return err
+	}
+	err = n.next.SendMessageContext(ctx, message, attachments...)
+	if err != nil {
+		n.forget(key, w, message.Addresses)
+	}
+	return err
+}
+
+// Send reports the suppressed messages as delivered without a message id.
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	message, key, w, err := n.check(message)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		res := &notification.Result{Channel: n.String()}
+		for _, addr := range message.Addresses {
+			res.Add(addr, "", nil)
+		}
+		return res, nil
+	}
+	res, err := notification.Send(ctx, n.next, message, attachments...)
+	if err != nil {
+		n.forget(key, w, message.Addresses)
+	} else if failed := res.Failed(); len(failed) > 0 {
+		addresses := make([]string, len(failed))
+		for i, d := range failed {
+			addresses[i] = d.Address
+		}
+		n.forget(key, w, addresses)
+	}
+	return res, err
+}
+
+// check reads the content of the message and returns the message to send
+// with the content replayed and its new window, or no window if it is
+// a duplicate to suppress.
+func (n *Notificator) check(message notification.Message) (notification.Message, string, *window, error) {
+	var content []byte
+	if message.Content != nil {
+		var err error
+		if content, err = io.ReadAll(message.Content); err != nil {
+			return message, "", nil, fmt.Errorf("read content: %w", err)
+		}
+		message.Content = bytes.NewReader(content)
+	}
+	key := n.fingerprint(message, string(content))
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if w, ok := n.windows[key]; ok {
+		w.count++
+		return message, key, nil, nil
+	}
+	w := &window{message: message, content: content, since: time.Now()}
+	w.timer = time.AfterFunc(n.cfg.Window, func() { n.expire(key, w) })
+	n.windows[key] = w
+	return message, key, w, nil
+}
+
+// forget closes the window of a message which failed to send to the
+// addresses, so the next equal message is sent rather than suppressed.
+// The duplicates suppressed while it was sending are sent to them in
+// the background as a summary.
+func (n *Notificator) forget(key string, w *window, addresses []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.windows[key] != w {
+		return
+	}
+	w.timer.Stop()
+	delete(n.windows, key)
+	if w.count > 0 {
+		w.message.Addresses = addresses
+		go n.summarize(w)
+	}
+}
+
+// fingerprint identifies equal messages to the same addresses.
+func (n *Notificator) fingerprint(message notification.Message, content string) string {
+	addresses := append([]string(nil), message.Addresses...)
+	sort.Strings(addresses)
+	if n.cfg.Fingerprint != nil {
+		return strings.Join(addresses, ",") + "\x00" + n.cfg.Fingerprint(message, content)
+	}
+
+	for _, re := range n.ignore {
+		content = re.ReplaceAllString(content, "")
+	}
+	content = strings.ToLower(strings.TrimSpace(spaces.ReplaceAllString(content, " ")))
+	h := sha256.New()
+	for _, addr := range addresses {
+		io.WriteString(h, addr+",")
+	}
+	if !n.cfg.WithoutSubject {
+		io.WriteString(h, "\x00"+message.Subject)
+	}
+	io.WriteString(h, "\x00"+message.Template+"\x00"+content)
+	if message.Data != nil {
+		fmt.Fprintf(h, "\x00%v", message.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (n *Notificator) expire(key string, w *window) {
+	n.mu.Lock()
+	if n.windows[key] != w {
+		n.mu.Unlock()
+		return
+	}
+	delete(n.windows, key)
+	n.mu.Unlock()
+	n.summarize(w)
+}
+
+func (n *Notificator) summarize(w *window) {
+	if w.count == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSummaryTimeout)
+	defer cancel()
+	if err := n.next.SendMessageContext(ctx, summary(w)); err != nil && n.cfg.OnError != nil {
+		n.cfg.OnError(err)
+	}
+}
+
+// Flush closes all the windows now, sending their summaries;
+// call it before shutdown so the suppressed counts aren't lost.
+func (n *Notificator) Flush() {
+	n.mu.Lock()
+	windows := n.windows
+	n.windows = make(map[string]*window)
+	n.mu.Unlock()
+
+	for _, w := range windows {
+		w.timer.Stop()
+		n.summarize(w)
+	}
+}
+
+// summary is the first message of the window with the repeat count prepended.
+func summary(w *window) notification.Message {
+	message := w.message
+	line := fmt.Sprintf("Repeated %d times since %s", w.count, w.since.Format(time.RFC3339))
+	if message.Subject != "" {
+		message.Subject = fmt.Sprintf("%s (repeated %d times)", message.Subject, w.count)
+	}
+	if message.Content == nil {
+		return message
+	}
+	switch message.Format {
+	case notification.FormatHTML:
+		line = "<p>" + html.EscapeString(line) + "</p>\n"
+	case notification.FormatMarkdown:
+		line = "*" + line + "*\n\n"
+	default:
+		line += "\n\n"
+	}
+	message.Content = io.MultiReader(strings.NewReader(line), bytes.NewReader(w.content))
+	return message
+}
@@ -0,0 +1,167 @@
+package dedup
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+)
+
+func TestNotificator_SendMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+
+	var sent []string
+	next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Times(3).
+		DoAndReturn(func(_ interface{}, m notification.Message, _ ...notification.Attachment) error {
+			content, _ := io.ReadAll(m.Content)
+			sent = append(sent, m.Subject+": "+string(content))
+			return nil
+		})
+
+	n, err := New(next, &Config{Window: time.Hour, Ignore: []string{`\d{2}:\d{2}:\d{2}`}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	messages := []struct {
+		subject, content string
+	}{
+		{"ReporterWorker", "12:00:01 connection   refused"},
+		{"ReporterWorker", "12:00:02 Connection refused"},
+		{"ReporterWorker", "12:00:03 connection refused\n"},
+		{"ReporterWorker", "12:00:04 disk full"},
+	}
+	for _, m := range messages {
+		msg := notification.Message{
+			Addresses: []string{"1"},
+			Subject:   m.subject,
+			Content:   strings.NewReader(m.content),
+			Format:    notification.FormatPlain,
+		}
+		if err := n.SendMessage(msg); err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+	}
+	if len(sent) != 2 {
+		t.Fatalf("SendMessage() sent = %q, want 2 messages", sent)
+	}
+
+	n.Flush()
+	if len(sent) != 3 {
+		t.Fatalf("Flush() sent = %q, want a summary", sent)
+	}
+	want := "ReporterWorker (repeated 2 times): Repeated 2 times since "
+	if !strings.HasPrefix(sent[2], want) || !strings.HasSuffix(sent[2], "\n\n12:00:01 connection   refused") {
+		t.Errorf("Flush() summary = %q, want %q...", sent[2], want)
+	}
+}
+
+func TestNotificator_SendFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	next.EXPECT().String().Return("email").AnyTimes()
+	gomock.InOrder(
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(errors.New("smtp down")),
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(nil),
+	)
+
+	n, err := New(next, &Config{Window: time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	msg := func() notification.Message {
+		return notification.Message{Addresses: []string{"ops@example.com"}, Content: strings.NewReader("disk full")}
+	}
+	if err := n.SendMessage(msg()); err == nil {
+		t.Fatal("SendMessage() error = nil, want smtp down")
+	}
+	// the failed message doesn't suppress the retry
+	if err := n.SendMessage(msg()); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	// the delivered one does
+	if err := n.SendMessage(msg()); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+}
+
+func TestNotificator_SendFailedDuplicates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	next.EXPECT().String().Return("email").AnyTimes()
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan string)
+	gomock.InOrder(
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ interface{}, _ notification.Message, _ ...notification.Attachment) error {
+				close(started)
+				<-release
+				return errors.New("smtp down")
+			}),
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ interface{}, m notification.Message, _ ...notification.Attachment) error {
+				done <- m.Subject
+				return nil
+			}),
+	)
+
+	n, err := New(next, &Config{Window: time.Hour})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	msg := func() notification.Message {
+		return notification.Message{Addresses: []string{"ops@example.com"}, Subject: "disk full"}
+	}
+	failed := make(chan error)
+	go func() { failed <- n.SendMessage(msg()) }()
+	<-started
+	// the duplicate arrives while the first message is sending
+	if err := n.SendMessage(msg()); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	close(release)
+	if err := <-failed; err == nil {
+		t.Fatal("SendMessage() error = nil, want smtp down")
+	}
+	if subject := <-done; subject != "disk full (repeated 1 times)" {
+		t.Errorf("summary subject = %q", subject)
+	}
+}
+
+func TestNotificator_fingerprint(t *testing.T) {
+	n, _ := New(nil, &Config{})
+	tests := []struct {
+		name      string
+		a, b      notification.Message
+		wantEqual bool
+	}{
+		{
+			name:      "Адреса в другом порядке",
+			a:         notification.Message{Addresses: []string{"1", "2"}, Subject: "s"},
+			b:         notification.Message{Addresses: []string{"2", "1"}, Subject: "s"},
+			wantEqual: true,
+		},
+		{
+			name: "Другие адреса",
+			a:    notification.Message{Addresses: []string{"1"}, Subject: "s"},
+			b:    notification.Message{Addresses: []string{"2"}, Subject: "s"},
+		},
+		{
+			name: "Другая тема",
+			a:    notification.Message{Addresses: []string{"1"}, Subject: "a"},
+			b:    notification.Message{Addresses: []string{"1"}, Subject: "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.fingerprint(tt.a, "") == n.fingerprint(tt.b, ""); got != tt.wantEqual {
+				t.Errorf("fingerprint() equal = %v, want %v", got, tt.wantEqual)
+			}
+		})
+	}
+}
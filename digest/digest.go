@@ -0,0 +1,205 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"redits.oculeus.com/asorokin/notification"
+	"redits.oculeus.com/asorokin/notification/render"
+	"redits.oculeus.com/asorokin/notification/retry"
+)
+
+const (
+	defaultInterval    = time.Hour
+	defaultMaxAttempts = 3
+)
+
+type Config struct {
+	// Interval is how often the collected messages are sent.
+	Interval time.Duration `cfg:"interval"`
+	// MaxMessages sends the digest of a recipient as soon as it has this
+	// many messages, 0 means no limit.
+	MaxMessages int `cfg:"max_messages"`
+	// Subject of the digest, "%d" is replaced by the number of messages.
+	Subject string `cfg:"subject"`
+	// MaxAttempts drops the digest of a recipient after this many
+	// sends failed in a row.
+	MaxAttempts int `cfg:"max_attempts"`
+	// OnError is called with the errors of the digests sent by Run
+	// or on reaching MaxMessages.
+	OnError func(err error) `cfg:"-"`
+}
+
+// Notificator collects the messages per recipient and sends them as one
+// message with all the attachments, see Run. The messages are combined
+// by their content, so wrap a notificator which gets rendered templates.
+type Notificator struct {
+	next    notification.Notificator
+	cfg     *Config
+	mu      sync.Mutex
+	batches map[string][]*entry
+	// failed counts the failed sends of the recipients' digests in a row.
+	failed map[string]int
+}
+
+type entry struct {
+	envelope *notification.Envelope
+	at       time.Time
+}
+
+func New(next notification.Notificator, cfg *Config) *Notificator {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = "Digest: %d messages"
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	return &Notificator{
+		next:    next,
+		cfg:     cfg,
+		batches: make(map[string][]*entry),
+		failed:  make(map[string]int),
+	}
+}
+
+func (n *Notificator) String() string {
+	return n.next.String()
+}
+
+func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+// SendMessageContext adds the message to the digests of its addresses;
+// a digest which reaches MaxMessages is sent right away. The message is
+// collected at this point, so the errors of that send go to OnError.
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	if len(message.Addresses) == 0 {
+		return notification.ErrNoAddresses
+	}
+	envelope, err := notification.NewEnvelope(message, attachments...)
+	if err != nil {
+		return err
+	}
+	e := &entry{envelope: envelope, at: time.Now()}
+
+	var full map[string][]*entry
+	n.mu.Lock()
+	for _, addr := range message.Addresses {
+		n.batches[addr] = append(n.batches[addr], e)
+		if n.cfg.MaxMessages > 0 && len(n.batches[addr]) >= n.cfg.MaxMessages {
+			if full == nil {
+				full = make(map[string][]*entry)
+			}
+			full[addr] = n.batches[addr]
+			delete(n.batches, addr)
+		}
+	}
+	n.mu.Unlock()
+	if err := n.send(ctx, full); err != nil && n.cfg.OnError != nil {
+		n.cfg.OnError(err)
+	}
+	return nil
+}
+
+// Len returns the number of recipients with collected messages.
+func (n *Notificator) Len() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.batches)
+}
+
+// Run sends the digests every Interval until ctx is done,
+// then sends what is left.
+func (n *Notificator) Run(ctx context.Context) error {
+	ticker := time.NewTicker(n.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return n.Flush(context.WithoutCancel(ctx))
+		case <-ticker.C:
+			if err := n.Flush(ctx); err != nil && n.cfg.OnError != nil {
+				n.cfg.OnError(err)
+			}
+		}
+	}
+}
+
+// Flush sends the digests of all the recipients now. The digests which
+// failed with a retryable error stay collected and are sent with the next
+// ones, up to MaxAttempts; the others are dropped.
+func (n *Notificator) Flush(ctx context.Context) error {
+	n.mu.Lock()
+	batches := n.batches
+	n.batches = make(map[string][]*entry)
+	n.mu.Unlock()
+	return n.send(ctx, batches)
+}
+
+func (n *Notificator) send(ctx context.Context, batches map[string][]*entry) error {
+	var errs []error
+	for addr, entries := range batches {
+		message, attachments := n.combine(entries)
+		message.Addresses = []string{addr}
+		err := n.next.SendMessageContext(ctx, message, attachments...)
+		n.mu.Lock()
+		if err == nil {
+			delete(n.failed, addr)
+			n.mu.Unlock()
+			continue
+		}
+		n.failed[addr]++
+		if ok, _ := retry.Classify(err); ok && n.failed[addr] < n.cfg.MaxAttempts {
+			// put the entries back before the ones collected meanwhile
+			n.batches[addr] = append(entries, n.batches[addr]...)
+			errs = append(errs, fmt.Errorf("digest for %s: %w", addr, err))
+		} else {
+			delete(n.failed, addr)
+			errs = append(errs, fmt.Errorf("digest for %s dropped: %w", addr, err))
+		}
+		n.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// combine makes one HTML message of the entries, a single entry is sent as is.
+func (n *Notificator) combine(entries []*entry) (notification.Message, []notification.Attachment) {
+	if len(entries) == 1 {
+		return entries[0].envelope.Open()
+	}
+
+	var (
+		b           strings.Builder
+		attachments []notification.Attachment
+	)
+	for i, e := range entries {
+		message, files := e.envelope.Open()
+		attachments = append(attachments, files...)
+		if i > 0 {
+			b.WriteString("<hr>\n")
+		}
+		title := e.at.Format("15:04:05")
+		if message.Subject != "" {
+			title += " " + message.Subject
+		}
+		b.WriteString("<h3>" + html.EscapeString(title) + "</h3>\n")
+		body, _ := io.ReadAll(message.Content)
+		b.WriteString(render.HTML(string(body), message.Format) + "\n")
+	}
+	return notification.Message{
+		Subject: strings.ReplaceAll(n.cfg.Subject, "%d", strconv.Itoa(len(entries))),
+		Content: strings.NewReader(b.String()),
+		Format:  notification.FormatHTML,
+	}, attachments
+}
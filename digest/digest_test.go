@@ -0,0 +1,145 @@
+package digest
+
+import (
+	"context"
+	"io"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+)
+
+func TestNotificator_Flush(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+
+	sent := make(map[string]notification.Message)
+	files := make(map[string]int)
+	next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).
+		DoAndReturn(func(_ interface{}, m notification.Message, att ...notification.Attachment) error {
+			sent[m.Addresses[0]] = m
+			files[m.Addresses[0]] = len(att)
+			return nil
+		})
+
+	n := New(next, &Config{MaxMessages: 3})
+	send := func(addresses []string, subject, content string, att ...notification.Attachment) {
+		err := n.SendMessage(notification.Message{
+			Addresses: addresses,
+			Subject:   subject,
+			Content:   strings.NewReader(content),
+			Format:    notification.FormatPlain,
+		}, att...)
+		if err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+	}
+	report := notification.Attachment{Filename: "report.csv", Content: strings.NewReader("a;b")}
+	send([]string{"a@example.com", "b@example.com"}, "first", "one & two", report)
+	send([]string{"a@example.com"}, "second", "three")
+	if len(sent) != 0 {
+		t.Fatalf("SendMessage() sent = %v, want nothing before Flush", sent)
+	}
+	send([]string{"a@example.com"}, "third", "four", notification.Attachment{Filename: "log.txt", Content: strings.NewReader("log")})
+	if got := sent["a@example.com"]; got.Subject != "Digest: 3 messages" || got.Format != notification.FormatHTML {
+		t.Fatalf("SendMessage() digest = %+v, want sent at MaxMessages", got)
+	}
+	if files["a@example.com"] != 2 {
+		t.Errorf("SendMessage() attachments = %d, want 2", files["a@example.com"])
+	}
+	body, _ := io.ReadAll(sent["a@example.com"].Content)
+	for _, want := range []string{"first</h3>", "one &amp; two", "second</h3>", "four"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("SendMessage() digest = %q, want %q", body, want)
+		}
+	}
+
+	if err := n.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	// a single message is sent as is
+	if got := sent["b@example.com"]; got.Subject != "first" || files["b@example.com"] != 1 {
+		t.Errorf("Flush() message = %+v, want the first message", got)
+	}
+	if n.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", n.Len())
+	}
+}
+
+func TestNotificator_FlushFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	var subjects []string
+	gomock.InOrder(
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(&textproto.Error{Code: 421, Msg: "service not available"}),
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ interface{}, m notification.Message, _ ...notification.Attachment) error {
+				subjects = append(subjects, m.Subject)
+				return nil
+			}),
+	)
+
+	n := New(next, &Config{})
+	for _, subject := range []string{"first", "second"} {
+		if err := n.SendMessage(notification.Message{Addresses: []string{"a@example.com"}, Subject: subject}); err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+	}
+	if err := n.Flush(context.Background()); err == nil {
+		t.Fatal("Flush() error = nil, want service not available")
+	}
+	if n.Len() != 1 {
+		t.Fatalf("Len() = %d, want the failed digest kept", n.Len())
+	}
+
+	if err := n.SendMessage(notification.Message{Addresses: []string{"a@example.com"}, Subject: "third"}); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if err := n.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if len(subjects) != 1 || subjects[0] != "Digest: 3 messages" {
+		t.Errorf("Flush() sent %q, want one digest of 3 messages", subjects)
+	}
+}
+
+func TestNotificator_FlushDropped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	gomock.InOrder(
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(&textproto.Error{Code: 421, Msg: "service not available"}),
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(&textproto.Error{Code: 421, Msg: "service not available"}),
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(&textproto.Error{Code: 550, Msg: "mailbox unavailable"}),
+	)
+
+	var errs []error
+	n := New(next, &Config{MaxAttempts: 2, OnError: func(err error) { errs = append(errs, err) }})
+	if err := n.SendMessage(notification.Message{Addresses: []string{"a@example.com"}, Subject: "first"}); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	// the temporary failures are retried up to MaxAttempts
+	for i := 0; i < 2; i++ {
+		if err := n.Flush(context.Background()); err == nil {
+			t.Fatal("Flush() error = nil, want service not available")
+		}
+	}
+	if n.Len() != 0 {
+		t.Fatalf("Len() = %d, want the digest dropped after MaxAttempts", n.Len())
+	}
+
+	// the permanent failure of a full digest is reported, the message is accepted
+	n.cfg.MaxMessages = 1
+	if err := n.SendMessage(notification.Message{Addresses: []string{"a@example.com"}, Subject: "second"}); err != nil {
+		t.Fatalf("SendMessage() error = %v, want nil for a collected message", err)
+	}
+	if n.Len() != 0 {
+		t.Errorf("Len() = %d, want the digest dropped", n.Len())
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "dropped: 550") {
+		t.Errorf("OnError() got %v, want the dropped digest", errs)
+	}
+}
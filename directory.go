@@ -0,0 +1,115 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrUnknownRecipient = errors.New("unknown recipient")
+
+// Directory resolves the logical names of the recipients, people or groups
+// like "oncall-db", into the addresses tagged with the channel, see Address.
+// StaticDirectory is the directory of the config, implement it to look
+// the names up elsewhere, e.g. in LDAP.
+type Directory interface {
+	Resolve(ctx context.Context, name string) ([]string, error)
+}
+
+// Person is a recipient of the directory.
+type Person struct {
+	// Addresses are the addresses of the person per channel,
+	// e.g. {"email": "ivanov@example.com", "telegram": "123456"}.
+	Addresses map[string]string `cfg:"addresses"`
+	// Channels are the channels the person is notified by, all by default.
+	Channels []string `cfg:"channels"`
+}
+
+func (p *Person) addresses() []string {
+	channels := p.Channels
+	if len(channels) == 0 {
+		for channel := range p.Addresses {
+			channels = append(channels, channel)
+		}
+		sort.Strings(channels)
+	}
+	addresses := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if addr := p.Addresses[channel]; addr != "" {
+			addresses = append(addresses, Address(channel, addr))
+		}
+	}
+	return addresses
+}
+
+// DirectoryConfig is the `directory:` section of the config.
+type DirectoryConfig struct {
+	People map[string]Person `cfg:"people"`
+	// Groups are the names of the members, people or other groups.
+	Groups map[string][]string `cfg:"groups"`
+}
+
+// StaticDirectory is the Directory of a DirectoryConfig.
+type StaticDirectory struct {
+	people map[string]Person
+	groups map[string][]string
+}
+
+// NewDirectory checks the people preferences and the group members.
+func NewDirectory(cfg *DirectoryConfig) (*StaticDirectory, error) {
+	for name, p := range cfg.People {
+		if _, ok := cfg.Groups[name]; ok {
+			return nil, fmt.Errorf("directory: %q is both a person and a group", name)
+		}
+		for _, channel := range p.Channels {
+			if p.Addresses[channel] == "" {
+				return nil, fmt.Errorf("directory: person %q: no %s address", name, channel)
+			}
+		}
+	}
+	d := &StaticDirectory{people: cfg.People, groups: cfg.Groups}
+	for name := range cfg.Groups {
+		if _, err := d.resolve(name, make(map[string]bool)); err != nil {
+			return nil, fmt.Errorf("directory: %w", err)
+		}
+	}
+	return d, nil
+}
+
+func (d *StaticDirectory) Resolve(_ context.Context, name string) ([]string, error) {
+	return d.resolve(name, make(map[string]bool))
+}
+
+// resolve returns the addresses of the person or of the group members,
+// path holds the groups being resolved to find the cycles.
+func (d *StaticDirectory) resolve(name string, path map[string]bool) ([]string, error) {
+	if p, ok := d.people[name]; ok {
+		return p.addresses(), nil
+	}
+	members, ok := d.groups[name]
+	if !ok {
+		return nil, fmt.Errorf("%q: %w", name, ErrUnknownRecipient)
+	}
+	if path[name] {
+		return nil, fmt.Errorf("group %q includes itself", name)
+	}
+	path[name] = true
+	defer delete(path, name)
+
+	var addresses []string
+	seen := make(map[string]bool)
+	for _, member := range members {
+		resolved, err := d.resolve(member, path)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %w", name, err)
+		}
+		for _, address := range resolved {
+			if !seen[address] {
+				seen[address] = true
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses, nil
+}
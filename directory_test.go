@@ -0,0 +1,149 @@
+package notification_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+)
+
+func testDirectory(t *testing.T) *notification.StaticDirectory {
+	dir, err := notification.NewDirectory(&notification.DirectoryConfig{
+		People: map[string]notification.Person{
+			"ivanov": {
+				Addresses: map[string]string{"email": "ivanov@example.com", "telegram": "100", "bitrix": "167"},
+				Channels:  []string{"telegram", "bitrix"},
+			},
+			"petrov": {
+				Addresses: map[string]string{"email": "petrov@example.com", "telegram": "200"},
+			},
+		},
+		Groups: map[string][]string{
+			"oncall-db": {"ivanov", "petrov"},
+			"oncall":    {"oncall-db", "ivanov"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewDirectory() error = %v", err)
+	}
+	return dir
+}
+
+func TestStaticDirectory_Resolve(t *testing.T) {
+	dir := testDirectory(t)
+	tests := []struct {
+		name    string
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "ivanov",
+			want: []string{"telegram:100", "bitrix:167"},
+		},
+		{
+			name: "petrov",
+			want: []string{"email:petrov@example.com", "telegram:200"},
+		},
+		{
+			name: "oncall",
+			want: []string{"telegram:100", "bitrix:167", "email:petrov@example.com", "telegram:200"},
+		},
+		{
+			name:    "sidorov",
+			wantErr: notification.ErrUnknownRecipient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dir.Resolve(context.Background(), tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewDirectory(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     notification.DirectoryConfig
+		wantErr string
+	}{
+		{
+			name: "Группа включает себя",
+			cfg: notification.DirectoryConfig{Groups: map[string][]string{
+				"a": {"b"},
+				"b": {"a"},
+			}},
+			wantErr: "includes itself",
+		},
+		{
+			name:    "Неизвестный участник",
+			cfg:     notification.DirectoryConfig{Groups: map[string][]string{"a": {"sidorov"}}},
+			wantErr: `"sidorov": unknown recipient`,
+		},
+		{
+			name: "Канал без адреса",
+			cfg: notification.DirectoryConfig{People: map[string]notification.Person{
+				"ivanov": {Addresses: map[string]string{"email": "ivanov@example.com"}, Channels: []string{"telegram"}},
+			}},
+			wantErr: "no telegram address",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := notification.NewDirectory(&tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewDirectory() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDispatcher_SendDirectory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	telegram := mock_notification.NewMockNotificator(ctrl)
+	telegram.EXPECT().String().Return("telegram").AnyTimes()
+	telegram.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, m notification.Message, _ ...notification.Attachment) error {
+			if !reflect.DeepEqual(m.Addresses, []string{"100", "200"}) {
+				t.Errorf("telegram got %v", m.Addresses)
+			}
+			return nil
+		})
+	email := mock_notification.NewMockNotificator(ctrl)
+	email.EXPECT().String().Return("email").AnyTimes()
+	email.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(errors.New("mailbox unavailable"))
+
+	d := notification.NewDispatcher(telegram, email).WithDirectory(testDirectory(t))
+	res, err := d.Send(context.Background(), notification.Message{
+		Addresses: []string{"oncall-db", "telegram:100", "sidorov"},
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	// a delivery for every given address, the names aren't replaced
+	if len(res.Deliveries) != 3 {
+		t.Fatalf("Deliveries = %+v, want 3", res.Deliveries)
+	}
+	if d := res.Deliveries[0]; d.Address != "oncall-db" ||
+		d.Err == nil || !strings.Contains(d.Err.Error(), "email:petrov@example.com: mailbox unavailable") {
+		t.Errorf("oncall-db = %+v, want failed by email:petrov@example.com", d)
+	}
+	if d := res.Deliveries[1]; d.Address != "telegram:100" || d.Channel != "telegram" || !d.OK() {
+		t.Errorf("telegram:100 = %+v, want delivered", d)
+	}
+	if d := res.Deliveries[2]; d.Address != "sidorov" || !errors.Is(d.Err, notification.ErrUnknownRecipient) {
+		t.Errorf("sidorov = %+v, want unknown recipient", d)
+	}
+}
@@ -0,0 +1,257 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var ErrUnknownChannel = errors.New("unknown channel")
+
+// Address tags addr with the channel name for the Dispatcher, e.g. "telegram:123456".
+func Address(channel, addr string) string {
+	return channel + ":" + addr
+}
+
+// SplitAddress splits the address tagged by Address.
+func SplitAddress(address string) (channel, addr string, ok bool) {
+	return strings.Cut(address, ":")
+}
+
+// ChannelError is the error of sending to some addresses of one channel.
+// Channel is empty for an address without a known channel, e.g. an
+// untagged address or a name the directory doesn't know.
+type ChannelError struct {
+	Channel   string
+	Addresses []string
+	Err       error
+}
+
+func (e *ChannelError) Error() string {
+	if e.Channel == "" {
+		return fmt.Sprintf("%s: %v", strings.Join(e.Addresses, ", "), e.Err)
+	}
+	return fmt.Sprintf("%s [%s]: %v", e.Channel, strings.Join(e.Addresses, ", "), e.Err)
+}
+
+func (e *ChannelError) Unwrap() error {
+	return e.Err
+}
+
+// DispatchError holds the errors of all failed channels.
+type DispatchError struct {
+	Errors []*ChannelError
+}
+
+func (e *DispatchError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "dispatch: " + strings.Join(msgs, "; ")
+}
+
+func (e *DispatchError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Dispatcher sends one message to several notificators at once.
+// The message addresses are tagged with the channel, see Address,
+// or are the names of a directory, see WithDirectory.
+type Dispatcher struct {
+	channels  map[string]Notificator
+	order     []string
+	directory Directory
+}
+
+func NewDispatcher(notificators ...Notificator) *Dispatcher {
+	d := &Dispatcher{
+		channels: make(map[string]Notificator, len(notificators)),
+	}
+	for _, n := range notificators {
+		if _, ok := d.channels[n.String()]; !ok {
+			d.order = append(d.order, n.String())
+		}
+		d.channels[n.String()] = n
+	}
+	return d
+}
+
+// WithDirectory resolves the untagged message addresses with the directory,
+// so they can be the names of people and groups. The addresses of the
+// channels the dispatcher doesn't have are skipped. A name is reported
+// as one delivery, so wrap the channels rather than the dispatcher with
+// retry: resending a partly failed name resends to all its addresses.
+func (d *Dispatcher) WithDirectory(dir Directory) *Dispatcher {
+	d.directory = dir
+	return d
+}
+
+func (d *Dispatcher) String() string {
+	return "dispatcher"
+}
+
+func (d *Dispatcher) SendMessage(message Message, attachments ...Attachment) error {
+	return d.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (d *Dispatcher) SendMessageContext(ctx context.Context, message Message, attachments ...Attachment) error {
+	res, err := d.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
+	}
+
+	var failed []*ChannelError
+	byChannel := make(map[string]*ChannelError)
+	for _, delivery := range res.Failed() {
+		channel := delivery.Channel
+		if channel == "" {
+			failed = append(failed, &ChannelError{Addresses: []string{delivery.Address}, Err: delivery.Err})
+			continue
+		}
+		_, addr, _ := SplitAddress(delivery.Address)
+		e, ok := byChannel[channel]
+		if !ok {
+			e = &ChannelError{Channel: channel}
+			byChannel[channel] = e
+			failed = append(failed, e)
+		}
+		e.Addresses = append(e.Addresses, addr)
+		// the backend errors leave out the address, tell which one failed how
+		err := fmt.Errorf("%s: %w", addr, delivery.Err)
+		if e.Err == nil {
+			e.Err = err
+		} else {
+			e.Err = errors.Join(e.Err, err)
+		}
+	}
+	if len(failed) > 0 {
+		return &DispatchError{Errors: failed}
+	}
+	return nil
+}
+
+// Send sends the message to all channels concurrently. The result has
+// a delivery for every address of the message with its channel; a name
+// of the directory fails if any of its addresses failed, the error
+// tells which ones.
+func (d *Dispatcher) Send(ctx context.Context, message Message, attachments ...Attachment) (*Result, error) {
+	if len(message.Addresses) == 0 {
+		return nil, ErrNoAddresses
+	}
+
+	// targets are the tagged addresses of every address of the message
+	targets := make([][]string, len(message.Addresses))
+	errs := make([]error, len(message.Addresses))
+	names := make([]bool, len(message.Addresses))
+	addresses := make(map[string][]string)
+	seen := make(map[string]bool)
+	add := func(i int, address string) bool {
+		channel, addr, ok := SplitAddress(address)
+		if _, known := d.channels[channel]; !ok || !known {
+			return false
+		}
+		targets[i] = append(targets[i], address)
+		if !seen[address] {
+			seen[address] = true
+			addresses[channel] = append(addresses[channel], addr)
+		}
+		return true
+	}
+	for i, address := range message.Addresses {
+		if add(i, address) {
+			continue
+		}
+		if _, _, tagged := SplitAddress(address); tagged || d.directory == nil {
+			errs[i] = ErrUnknownChannel
+			continue
+		}
+		names[i] = true
+		resolved, err := d.directory.Resolve(ctx, address)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		for _, r := range resolved {
+			add(i, r)
+		}
+		if len(targets[i]) == 0 {
+			errs[i] = ErrUnknownChannel
+		}
+	}
+
+	envelope, err := NewEnvelope(message, attachments...)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		deliveries = make(map[string]Delivery, len(seen))
+	)
+	for _, channel := range d.order {
+		if len(addresses[channel]) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(channel string) {
+			defer wg.Done()
+			msg, att := envelope.Open()
+			msg.Addresses = addresses[channel]
+			chRes, err := Send(ctx, d.channels[channel], msg, att...)
+			byAddress := make(map[string]Delivery)
+			if err == nil {
+				for _, delivery := range chRes.Deliveries {
+					byAddress[delivery.Address] = delivery
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, addr := range msg.Addresses {
+				delivery, ok := byAddress[addr]
+				switch {
+				case err != nil:
+					delivery = Delivery{Err: err}
+				case !ok:
+					// the channel reported other addresses, e.g. a Fallback
+					delivery = Delivery{Err: chRes.Err()}
+				}
+				delivery.Address, delivery.Channel = Address(channel, addr), channel
+				deliveries[delivery.Address] = delivery
+			}
+		}(channel)
+	}
+	wg.Wait()
+
+	res := &Result{Channel: d.String()}
+	for i, address := range message.Addresses {
+		switch {
+		case errs[i] != nil:
+			res.Add(address, "", errs[i])
+		case !names[i]:
+			res.Deliveries = append(res.Deliveries, deliveries[address])
+		default:
+			delivery := Delivery{Address: address}
+			var failed []error
+			for _, target := range targets[i] {
+				if t := deliveries[target]; !t.OK() {
+					failed = append(failed, fmt.Errorf("%s: %w", target, t.Err))
+				}
+			}
+			delivery.Err = errors.Join(failed...)
+			if len(targets[i]) == 1 {
+				t := deliveries[targets[i][0]]
+				delivery.Channel, delivery.MessageID = t.Channel, t.MessageID
+			}
+			res.Deliveries = append(res.Deliveries, delivery)
+		}
+	}
+	return res, nil
+}
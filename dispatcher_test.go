@@ -0,0 +1,89 @@
+package notification_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+)
+
+func TestDispatcher_SendMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	email := mock_notification.NewMockNotificator(ctrl)
+	email.EXPECT().String().Return("email").AnyTimes()
+	email.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ interface{}, m notification.Message, _ ...notification.Attachment) error {
+			body, _ := io.ReadAll(m.Content)
+			if string(body) != "text" || len(m.Addresses) != 2 {
+				t.Errorf("email got %v %q", m.Addresses, body)
+			}
+			return nil
+		})
+
+	telegram := mock_notification.NewMockNotificator(ctrl)
+	telegram.EXPECT().String().Return("telegram").AnyTimes()
+	telegram.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ interface{}, m notification.Message, _ ...notification.Attachment) error {
+			body, _ := io.ReadAll(m.Content)
+			if string(body) != "text" || m.Addresses[0] != "123" {
+				t.Errorf("telegram got %v %q", m.Addresses, body)
+			}
+			return errors.New("chat not found")
+		})
+
+	d := notification.NewDispatcher(email, telegram)
+	err := d.SendMessage(notification.Message{
+		Addresses: []string{
+			notification.Address("email", "a@mail.xyz"),
+			notification.Address("telegram", "123"),
+			notification.Address("email", "b@mail.xyz"),
+			"slack:general",
+			"12345",
+		},
+		Content: strings.NewReader("text"),
+	})
+
+	var dispatchErr *notification.DispatchError
+	if !errors.As(err, &dispatchErr) || len(dispatchErr.Errors) != 3 {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if !errors.Is(err, notification.ErrUnknownChannel) {
+		t.Errorf("SendMessage() error = %v, want ErrUnknownChannel", err)
+	}
+	if !strings.Contains(err.Error(), "telegram [123]: 123: chat not found") {
+		t.Errorf("SendMessage() error = %v", err)
+	}
+	var unknown []string
+	for _, e := range dispatchErr.Errors {
+		if e.Channel == "" {
+			unknown = append(unknown, e.Addresses...)
+		}
+	}
+	if strings.Join(unknown, ",") != "slack:general,12345" {
+		t.Errorf("unknown channel addresses = %q, want the original addresses", unknown)
+	}
+	if !strings.Contains(err.Error(), "12345: unknown channel") {
+		t.Errorf("SendMessage() error = %v", err)
+	}
+}
+
+func TestDispatcher_SendMessageAddresses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	telegram := mock_notification.NewMockNotificator(ctrl)
+	telegram.EXPECT().String().Return("telegram").AnyTimes()
+	telegram.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(errors.New("forbidden"))
+
+	err := notification.NewDispatcher(telegram).SendMessage(notification.Message{
+		Addresses: []string{"telegram:1", "telegram:2"},
+	})
+	want := "dispatch: telegram [1, 2]: 1: forbidden\n2: forbidden"
+	if err == nil || err.Error() != want {
+		t.Errorf("SendMessage() error = %q, want %q", err, want)
+	}
+}
@@ -1,23 +1,57 @@
 package email
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"io"
+	"log/slog"
+	"net"
 	"net/mail"
 	"net/smtp"
+	"net/textproto"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/jordan-wright/email"
+	"go.opentelemetry.io/otel/attribute"
 
 	"redits.oculeus.com/asorokin/notification"
+	"redits.oculeus.com/asorokin/notification/render"
+	"redits.oculeus.com/asorokin/notification/tracing"
 )
 
+const Name = "email"
+
+// priorities are the X-Priority headers of the severities,
+// info and the messages without a level are sent as normal.
+var priorities = map[notification.Severity]string{
+	notification.SeverityCritical: "1 (Highest)",
+	notification.SeverityError:    "2 (High)",
+	notification.SeverityDebug:    "5 (Lowest)",
+}
+
+func init() {
+	notification.Register(Name, func(decode func(interface{}) error, opts ...notification.Option) (notification.Notificator, error) {
+		cfg := &Config{}
+		if err := decode(cfg); err != nil {
+			return nil, err
+		}
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		return New(cfg, opts...), nil
+	})
+}
+
 type Notificator struct {
 	cfg *Config
+	log *slog.Logger
 }
 
 func (n *Notificator) String() string {
-	return "email"
+	return Name
 }
 
 type Config struct {
@@ -28,11 +62,31 @@ type Config struct {
 	VisibleName string        `cfg:"visible_name"`
 	Timeout     time.Duration `cfg:"timeout"`
 	WithoutAuth bool          `cfg:"without_auth"`
-	// TemplHTML   bool
 }
 
-func New(cfg *Config) *Notificator {
-	return &Notificator{cfg}
+func (c *Config) Validate() error {
+	var missing []string
+	if c.SmtpHost == "" {
+		missing = append(missing, "smtp_host")
+	}
+	if c.SmtpPort == "" {
+		missing = append(missing, "smtp_port")
+	}
+	if c.SmtpUser == "" {
+		missing = append(missing, "smtp_user")
+	}
+	if c.SmtpPass == "" && !c.WithoutAuth {
+		missing = append(missing, "smtp_pass")
+	}
+	return notification.MissingFields(Name, missing...)
+}
+
+func New(cfg *Config, opts ...notification.Option) *Notificator {
+	o := notification.NewOptions(opts...)
+	return &Notificator{
+		cfg: cfg,
+		log: o.Logger.With(notification.LogChannel, Name),
+	}
 }
 
 type userinfo struct {
@@ -63,8 +117,32 @@ func (u *userinfo) Next(fromServer []byte, more bool) ([]byte, error) {
 }
 
 func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	res, err := n.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+// Send sends one email to all the addresses. The addresses rejected by the
+// server fail separately, the others share the SMTP queue id as message id.
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	ctx, span := tracing.Start(ctx, Name, Name+" send",
+		tracing.RecipientsKey.Int(len(message.Addresses)),
+		tracing.AttachmentsKey.Int(len(attachments)),
+	)
+	res, err := n.deliver(ctx, message, attachments...)
+	tracing.EndResult(span, res, err)
+	return res, err
+}
+
+func (n *Notificator) deliver(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
 	if len(message.Addresses) == 0 {
-		return errors.New("no addresses to send")
+		return nil, notification.ErrNoAddresses
 	}
 
 	from := mail.Address{
@@ -73,13 +151,36 @@ func (n *Notificator) SendMessage(message notification.Message, attachments ...n
 	}
 	body, err := io.ReadAll(message.Content)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// a malformed address fails alone, the message goes to the others
+	res := &notification.Result{Channel: Name}
+	var valid []string
+	rcpt := make(map[string]string, len(message.Addresses))
+	for _, addr := range message.Addresses {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			n.log.WarnContext(ctx, "invalid address", notification.LogAddress, addr, notification.LogError, err.Error())
+			res.Add(addr, "", notification.NewSendError(Name, addr, "", notification.ErrInvalidAddress, err))
+			continue
+		}
+		valid = append(valid, addr)
+		rcpt[addr] = a.Address
+	}
+	if len(valid) == 0 {
+		return res, nil
 	}
+
 	m := &email.Email{
 		From:    from.String(),
-		To:      message.Addresses,
+		To:      valid,
 		Subject: message.Subject,
-		HTML:    body,
+		HTML:    []byte(render.HTML(string(body), message.Format)),
+		Text:    []byte(render.Plain(string(body), message.Format)),
+	}
+	if priority, ok := priorities[message.Severity]; ok {
+		m.Headers = textproto.MIMEHeader{"X-Priority": {priority}}
 	}
 	if attachments != nil {
 		for _, a := range attachments {
@@ -87,29 +188,165 @@ func (n *Notificator) SendMessage(message notification.Message, attachments ...n
 				continue
 			}
 			if _, err := m.Attach(a.Content, a.Filename, a.ContentType); err != nil {
-				return err
+				return nil, err
 			}
 		}
 	}
 
-	var auth smtp.Auth = nil
-	if !n.cfg.WithoutAuth {
-		auth = loginAuth(n.cfg.SmtpUser, n.cfg.SmtpPass)
+	if n.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.cfg.Timeout)
+		defer cancel()
+	}
+	smtpCtx, span := tracing.Start(ctx, Name, "smtp "+n.cfg.SmtpHost,
+		attribute.String("smtp.host", n.cfg.SmtpHost),
+		tracing.RecipientsKey.Int(len(m.To)),
+	)
+	rejected, queueID, err := n.send(smtpCtx, m, rcpt)
+	if queueID != "" {
+		span.SetAttributes(tracing.MessageIDKey.String(queueID))
+	}
+	span.SetAttributes(tracing.FailedKey.Int(len(rejected)))
+	tracing.End(span, err)
+	if err != nil && ctx.Err() != nil {
+		// the connection is closed by the context, its error says nothing
+		err = ctx.Err()
 	}
 
-	var sendChannel chan error
-	if n.cfg.Timeout > 0 {
-		sendChannel = make(chan error, 1)
-		go func() {
-			sendChannel <- m.Send(n.cfg.SmtpHost+":"+n.cfg.SmtpPort, auth)
-		}()
+	if err != nil {
+		n.log.WarnContext(ctx, "send failed", notification.LogError, notification.Redact(err.Error(), n.cfg.SmtpPass))
 	} else {
-		return m.Send(n.cfg.SmtpHost+":"+n.cfg.SmtpPort, auth)
+		n.log.DebugContext(ctx, "sent", notification.LogMessageID, queueID, "rejected", len(rejected))
+	}
+	for addr, rcptErr := range rejected {
+		n.log.WarnContext(ctx, "recipient rejected", notification.LogAddress, addr, notification.LogError, rcptErr.Error())
+	}
+
+	for _, addr := range valid {
+		switch {
+		case err != nil:
+			res.Add(addr, "", sendError(addr, err, false))
+		case rejected[addr] != nil:
+			res.Add(addr, "", sendError(addr, rejected[addr], true))
+		default:
+			res.Add(addr, queueID, nil)
+		}
+	}
+	return res, nil
+}
+
+// sendError makes a *notification.SendError of the error sending to the
+// address, rcpt is set for the errors of the RCPT command.
+func sendError(addr string, err error, rcpt bool) error {
+	var (
+		code    string
+		kind    error
+		smtpErr *textproto.Error
+	)
+	if !errors.As(err, &smtpErr) {
+		return notification.NewSendError(Name, addr, code, kind, err)
+	}
+	code = strconv.Itoa(smtpErr.Code)
+	switch {
+	case smtpErr.Code == 530, smtpErr.Code == 534, smtpErr.Code == 535:
+		kind = notification.ErrUnauthorized
+	case rcpt && smtpErr.Code >= 500:
+		kind = notification.ErrInvalidAddress
+	}
+	se := notification.NewSendError(Name, addr, code, kind, err)
+	// 4xx are transient failures by RFC 5321
+	se.Transient = se.Transient || smtpErr.Code >= 400 && smtpErr.Code < 500
+	return se
+}
+
+var queuedAs = regexp.MustCompile(`(?i)queued as\s+([^\s;]+)`)
+
+// send does the same as smtp.SendMail, but the connection lives within ctx.
+// rcpt are the parsed addresses of m.To for the RCPT commands.
+// It returns the errors of the rejected recipients and the queue id
+// reported by the server if any.
+func (n *Notificator) send(ctx context.Context, m *email.Email, rcpt map[string]string) (map[string]error, string, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, "", err
+	}
+	raw, err := m.Bytes()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(n.cfg.SmtpHost, n.cfg.SmtpPort))
+	if err != nil {
+		return nil, "", err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, n.cfg.SmtpHost)
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.cfg.SmtpHost}); err != nil {
+			return nil, "", err
+		}
+	}
+	if !n.cfg.WithoutAuth {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return nil, "", errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(loginAuth(n.cfg.SmtpUser, n.cfg.SmtpPass)); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return nil, "", err
+	}
+	rejected := make(map[string]error)
+	for _, addr := range m.To {
+		if err := c.Rcpt(rcpt[addr]); err != nil {
+			rejected[addr] = err
+		}
+	}
+	if len(rejected) == len(m.To) {
+		c.Quit()
+		return rejected, "", nil
+	}
+
+	// DATA by hand, smtp.Client drops the final reply with the queue id
+	id, err := c.Text.Cmd("DATA")
+	if err != nil {
+		return nil, "", err
+	}
+	c.Text.StartResponse(id)
+	_, _, err = c.Text.ReadResponse(354)
+	c.Text.EndResponse(id)
+	if err != nil {
+		return nil, "", err
+	}
+	w := c.Text.DotWriter()
+	if _, err := w.Write(raw); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	_, reply, err := c.Text.ReadResponse(250)
+	if err != nil {
+		return nil, "", err
 	}
-	select {
-	case sendErr := <-sendChannel:
-		return sendErr
-	case <-time.After(n.cfg.Timeout):
-		return errors.New("email sending timed out")
+	var queueID string
+	if match := queuedAs.FindStringSubmatch(reply); match != nil {
+		queueID = match[1]
 	}
+	// the message is accepted already, the QUIT reply doesn't matter
+	c.Quit()
+	return rejected, queueID, nil
 }
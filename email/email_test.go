@@ -0,0 +1,258 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+// smtpServer is a fake SMTP server without STARTTLS and AUTH: it rejects
+// the recipients at unknown.example.com and queues the messages as "4XyZ1".
+type smtpServer struct {
+	addr string
+	mu   sync.Mutex
+	rcpt []string
+	data string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &smtpServer{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.Fields(line + " ")[0])
+		switch cmd {
+		case "EHLO", "HELO", "MAIL", "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			if strings.Contains(line, "@unknown.example.com") {
+				tp.PrintfLine("550 5.1.1 User unknown")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpt = append(s.rcpt, line)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			s.mu.Unlock()
+			tp.PrintfLine("250 2.0.0 Ok: queued as 4XyZ1")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func testNotificator(addr string) *Notificator {
+	host, port, _ := net.SplitHostPort(addr)
+	return New(&Config{
+		SmtpUser:    "noreply@example.com",
+		SmtpHost:    host,
+		SmtpPort:    port,
+		VisibleName: "ServiceName",
+		WithoutAuth: true,
+	})
+}
+
+func TestNotificator_Send(t *testing.T) {
+	srv := newSMTPServer(t)
+	n := testNotificator(srv.addr)
+
+	res, err := n.Send(context.Background(), notification.Message{
+		Addresses: []string{"ops@example.com", "nobody@unknown.example.com", "not an address"},
+		Subject:   "Disk full",
+		Content:   strings.NewReader("disk is 95% full"),
+		Severity:  notification.SeverityCritical,
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	got := make(map[string]notification.Delivery)
+	for _, d := range res.Deliveries {
+		got[d.Address] = d
+	}
+	if d := got["ops@example.com"]; !d.OK() || d.MessageID != "4XyZ1" {
+		t.Errorf("ops@example.com = %+v, want queue id 4XyZ1", d)
+	}
+	for _, addr := range []string{"nobody@unknown.example.com", "not an address"} {
+		var se *notification.SendError
+		d := got[addr]
+		if !errors.Is(d.Err, notification.ErrInvalidAddress) || !errors.As(d.Err, &se) || se.Temporary() {
+			t.Errorf("%s = %+v, want a permanent invalid address", addr, d)
+		}
+	}
+	if len(res.Deliveries) != 3 {
+		t.Errorf("Deliveries = %+v, want 3", res.Deliveries)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.rcpt) != 1 || !strings.Contains(srv.rcpt[0], "<ops@example.com>") {
+		t.Errorf("RCPT = %q, want only ops@example.com", srv.rcpt)
+	}
+	if !strings.Contains(srv.data, "X-Priority: 1 (Highest)") {
+		t.Errorf("DATA has no X-Priority header:\n%s", srv.data)
+	}
+	if strings.Contains(srv.data, "not an address") {
+		t.Errorf("DATA has the malformed address:\n%s", srv.data)
+	}
+}
+
+func TestNotificator_SendWithoutAuth(t *testing.T) {
+	srv := newSMTPServer(t)
+	n := testNotificator(srv.addr)
+	n.cfg.WithoutAuth = false
+	n.cfg.SmtpPass = "secret"
+
+	err := n.SendMessage(notification.Message{
+		Addresses: []string{"ops@example.com"},
+		Content:   strings.NewReader("disk full"),
+	})
+	if err == nil || !strings.Contains(err.Error(), "doesn't support AUTH") {
+		t.Errorf("SendMessage() error = %v, want the server doesn't support AUTH", err)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.rcpt) != 0 {
+		t.Errorf("RCPT = %q, want none without AUTH", srv.rcpt)
+	}
+}
+
+func TestNotificator_SendCanceled(t *testing.T) {
+	// the server accepts the connection but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufio.NewReader(conn).ReadString('\n')
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	done := make(chan struct{})
+	var res *notification.Result
+	go func() {
+		defer close(done)
+		res, err = testNotificator(ln.Addr().String()).Send(ctx, notification.Message{
+			Addresses: []string{"ops@example.com"},
+			Content:   strings.NewReader("disk full"),
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send() doesn't return after the context is canceled")
+	}
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if failed := res.Failed(); len(failed) != 1 || !errors.Is(failed[0].Err, context.Canceled) {
+		t.Errorf("Send() = %+v, want context canceled", res.Deliveries)
+	}
+}
+
+func Test_sendError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		rcpt          bool
+		wantKind      error
+		wantTemporary bool
+	}{
+		{
+			name:     "Неверный пароль",
+			err:      &textproto.Error{Code: 535, Msg: "5.7.8 Authentication credentials invalid"},
+			wantKind: notification.ErrUnauthorized,
+		},
+		{
+			name:     "Получатель отклонён",
+			err:      &textproto.Error{Code: 550, Msg: "5.1.1 User unknown"},
+			rcpt:     true,
+			wantKind: notification.ErrInvalidAddress,
+		},
+		{
+			name:          "Временная ошибка",
+			err:           &textproto.Error{Code: 451, Msg: "4.3.0 Try again later"},
+			wantTemporary: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sendError("ops@example.com", tt.err, tt.rcpt)
+			var se *notification.SendError
+			if !errors.As(err, &se) {
+				t.Fatalf("sendError() = %T, want *notification.SendError", err)
+			}
+			if tt.wantKind != nil && !errors.Is(err, tt.wantKind) {
+				t.Errorf("sendError() = %v, want %v", err, tt.wantKind)
+			}
+			if se.Temporary() != tt.wantTemporary {
+				t.Errorf("Temporary() = %v, want %v", se.Temporary(), tt.wantTemporary)
+			}
+		})
+	}
+}
+
+func Test_queuedAs(t *testing.T) {
+	for reply, want := range map[string]string{
+		"2.0.0 Ok: queued as 4XyZ1":             "4XyZ1",
+		"OK id=1abcde-000Xyz-Ab; queued as AB1": "AB1",
+		"2.0.0 Message accepted for delivery":   "",
+	} {
+		var got string
+		if match := queuedAs.FindStringSubmatch(reply); match != nil {
+			got = match[1]
+		}
+		if got != want {
+			t.Errorf("queue id of %q = %q, want %q", reply, got, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package notification
+
+import (
+	"bytes"
+	"io"
+)
+
+// Envelope is a Message with its content and attachments read into memory,
+// so it can be sent more than once or stored.
+type Envelope struct {
+	Message     Message
+	Content     []byte
+	Attachments []File
+}
+
+type File struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+func NewEnvelope(message Message, attachments ...Attachment) (*Envelope, error) {
+	e := &Envelope{Message: message}
+	e.Message.Content = nil
+	if message.Content != nil {
+		body, err := io.ReadAll(message.Content)
+		if err != nil {
+			return nil, err
+		}
+		e.Content = body
+	}
+	for _, a := range attachments {
+		if a.Content == nil {
+			continue
+		}
+		content, err := io.ReadAll(a.Content)
+		if err != nil {
+			return nil, err
+		}
+		e.Attachments = append(e.Attachments, File{
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			Content:     content,
+		})
+	}
+	return e, nil
+}
+
+// Open returns the message and attachments with fresh readers over the stored content.
+func (e *Envelope) Open() (Message, []Attachment) {
+	message := e.Message
+	message.Addresses = append([]string(nil), e.Message.Addresses...)
+	message.Content = bytes.NewReader(e.Content)
+	var attachments []Attachment
+	for _, f := range e.Attachments {
+		attachments = append(attachments, Attachment{
+			Filename:    f.Filename,
+			ContentType: f.ContentType,
+			Content:     bytes.NewReader(f.Content),
+		})
+	}
+	return message, attachments
+}
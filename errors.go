@@ -0,0 +1,125 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+var (
+	ErrNoAddresses    = errors.New("no addresses to send")
+	ErrTimeout        = errors.New("sending timed out")
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrRateLimited    = errors.New("rate limited")
+	ErrInvalidAddress = errors.New("invalid address")
+)
+
+// SendError is the error of sending a message to one address, returned by
+// the backends. Use errors.Is with the Err* sentinels to check its Kind and
+// errors.As to get the backend error, e.g. *telegram.APIError.
+type SendError struct {
+	Channel string
+	Address string
+	// Code is the error code of the backend: Telegram error_code,
+	// Bitrix error or SMTP reply code.
+	Code string
+	// Kind is one of the Err* sentinels, nil if the error is none of them.
+	Kind error
+	Err  error
+	// Transient is true if the message may be sent later, see Temporary.
+	Transient bool
+	// Delay is the wait asked by the server, see RetryAfter.
+	Delay time.Duration
+}
+
+// NewSendError makes a *SendError of the backend error. If kind is nil it
+// is found by errors.Is, timeouts are recognized too. The error is transient
+// if its kind is a timeout or rate limit, it is a network error or it has
+// Temporary() returning true; its RetryAfter() sets the delay.
+// An err which is a *SendError already gets the channel and address only.
+func NewSendError(channel, address, code string, kind, err error) *SendError {
+	if se, ok := err.(*SendError); ok {
+		se.Channel, se.Address = channel, address
+		return se
+	}
+
+	if kind == nil {
+		kind = kindOf(err)
+	}
+	e := &SendError{
+		Channel: channel,
+		Address: address,
+		Code:    code,
+		Kind:    kind,
+		Err:     err,
+	}
+	var hint interface{ RetryAfter() time.Duration }
+	if errors.As(err, &hint) {
+		e.Delay = hint.RetryAfter()
+	}
+	switch {
+	case kind == ErrTimeout, kind == ErrRateLimited:
+		e.Transient = true
+	case errors.Is(err, context.Canceled):
+	default:
+		var temporary interface{ Temporary() bool }
+		var netErr net.Error
+		if errors.As(err, &temporary) {
+			if _, isNet := temporary.(net.Error); !isNet {
+				e.Transient = temporary.Temporary()
+				break
+			}
+		}
+		e.Transient = errors.As(err, &netErr)
+	}
+	return e
+}
+
+// kindOf finds the sentinel the error wraps or is like.
+func kindOf(err error) error {
+	for _, kind := range []error{ErrNoAddresses, ErrTimeout, ErrUnauthorized, ErrRateLimited, ErrInvalidAddress} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTimeout
+	}
+	return nil
+}
+
+// Error doesn't repeat the channel and address, a *ChannelError holding it has them.
+func (e *SendError) Error() string {
+	switch {
+	case e.Err == nil && e.Kind == nil:
+		return "send error"
+	case e.Err == nil:
+		return e.Kind.Error()
+	case e.Kind == nil || errors.Is(e.Err, e.Kind):
+		return e.Err.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *SendError) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// Temporary reports whether the message may be sent later.
+func (e *SendError) Temporary() bool {
+	return e.Transient
+}
+
+// RetryAfter is the delay asked by the server, 0 if none.
+func (e *SendError) RetryAfter() time.Duration {
+	return e.Delay
+}
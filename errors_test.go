@@ -0,0 +1,75 @@
+package notification_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"redits.oculeus.com/asorokin/notification"
+	"redits.oculeus.com/asorokin/notification/telegram"
+)
+
+func TestNewSendError(t *testing.T) {
+	tests := []struct {
+		name          string
+		kind          error
+		err           error
+		wantKind      error
+		wantTemporary bool
+		wantMessage   string
+	}{
+		{
+			name:          "Таймаут контекста",
+			err:           context.DeadlineExceeded,
+			wantKind:      notification.ErrTimeout,
+			wantTemporary: true,
+			wantMessage:   "sending timed out: context deadline exceeded",
+		},
+		{
+			name:          "Превышен лимит с задержкой",
+			kind:          notification.ErrRateLimited,
+			err:           &telegram.APIError{Code: 429, Description: "Too Many Requests"},
+			wantKind:      notification.ErrRateLimited,
+			wantTemporary: true,
+			wantMessage:   "rate limited: error:429: Too Many Requests",
+		},
+		{
+			name:        "Вид ошибки из обёртки",
+			err:         fmt.Errorf("%w: bad chat", notification.ErrInvalidAddress),
+			wantKind:    notification.ErrInvalidAddress,
+			wantMessage: "invalid address: bad chat",
+		},
+		{
+			name:          "Временная ошибка бэкенда",
+			err:           &telegram.APIError{Code: 502, Description: "Bad Gateway"},
+			wantTemporary: true,
+			wantMessage:   "error:502: Bad Gateway",
+		},
+		{
+			name:        "Отмена вызова",
+			err:         context.Canceled,
+			wantMessage: "context canceled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := notification.NewSendError("telegram", "123", "", tt.kind, tt.err)
+			if err.Kind != tt.wantKind {
+				t.Errorf("NewSendError() kind = %v, want %v", err.Kind, tt.wantKind)
+			}
+			if tt.wantKind != nil && !errors.Is(err, tt.wantKind) {
+				t.Errorf("errors.Is(%v) = false", tt.wantKind)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("errors.Is(%v) = false", tt.err)
+			}
+			if err.Temporary() != tt.wantTemporary {
+				t.Errorf("Temporary() = %v, want %v", err.Temporary(), tt.wantTemporary)
+			}
+			if err.Error() != tt.wantMessage {
+				t.Errorf("Error() = %q, want %q", err.Error(), tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type FallbackConfig struct {
+	// Chain lists the channels in the order they are tried,
+	// empty means the order of the notificators given to NewFallback.
+	Chain []string `cfg:"chain"`
+	// Addresses maps a recipient to its address in every channel, e.g.
+	// oncall: {bitrix: "chat42", telegram: "123456", email: "oncall@example.com"}.
+	// A mapped recipient skips the channels it has no address in,
+	// a recipient which isn't mapped is sent as is to every channel.
+	Addresses map[string]map[string]string `cfg:"addresses"`
+}
+
+// Fallback sends a message through the first channel of the chain and tries
+// the next one for the addresses which failed, e.g. bitrix → telegram → email.
+// Wrap the notificators with retry to fall through only after repeated failures.
+type Fallback struct {
+	cfg   *FallbackConfig
+	chain []Notificator
+}
+
+func NewFallback(cfg *FallbackConfig, notificators ...Notificator) (*Fallback, error) {
+	f := &Fallback{cfg: cfg}
+	if len(cfg.Chain) == 0 {
+		f.chain = notificators
+		return f, nil
+	}
+	byName := make(map[string]Notificator, len(notificators))
+	for _, n := range notificators {
+		byName[n.String()] = n
+	}
+	for _, channel := range cfg.Chain {
+		n, ok := byName[channel]
+		if !ok {
+			return nil, fmt.Errorf("fallback %q: %w", channel, ErrUnknownChannel)
+		}
+		f.chain = append(f.chain, n)
+	}
+	return f, nil
+}
+
+func (f *Fallback) String() string {
+	return "fallback"
+}
+
+func (f *Fallback) SendMessage(message Message, attachments ...Attachment) error {
+	return f.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (f *Fallback) SendMessageContext(ctx context.Context, message Message, attachments ...Attachment) error {
+	res, err := f.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+// address returns the address of the recipient in the channel.
+func (f *Fallback) address(recipient, channel string) (string, bool) {
+	channels, ok := f.cfg.Addresses[recipient]
+	if !ok {
+		return recipient, true
+	}
+	addr, ok := channels[channel]
+	return addr, ok && addr != ""
+}
+
+// Send reports every address with the channel which delivered it in
+// Delivery.Channel; a failed address has the last channel tried and
+// its error joins the *ChannelError of every channel.
+func (f *Fallback) Send(ctx context.Context, message Message, attachments ...Attachment) (*Result, error) {
+	if len(message.Addresses) == 0 {
+		return nil, ErrNoAddresses
+	}
+	envelope, err := NewEnvelope(message, attachments...)
+	if err != nil {
+		return nil, err
+	}
+
+	type outcome struct {
+		channel   string
+		messageID string
+		errs      []error
+		sent      bool
+	}
+	outcomes := make(map[string]*outcome, len(message.Addresses))
+	pending := make([]string, 0, len(message.Addresses))
+	for _, recipient := range message.Addresses {
+		if _, dup := outcomes[recipient]; !dup {
+			outcomes[recipient] = &outcome{}
+			pending = append(pending, recipient)
+		}
+	}
+
+	for _, n := range f.chain {
+		if len(pending) == 0 || ctx.Err() != nil {
+			break
+		}
+		channel := n.String()
+		recipients := make(map[string][]string)
+		var addresses []string
+		for _, recipient := range pending {
+			addr, ok := f.address(recipient, channel)
+			if !ok {
+				continue
+			}
+			if _, ok := recipients[addr]; !ok {
+				addresses = append(addresses, addr)
+			}
+			recipients[addr] = append(recipients[addr], recipient)
+		}
+		if len(addresses) == 0 {
+			continue
+		}
+
+		msg, att := envelope.Open()
+		msg.Addresses = addresses
+		chRes, err := Send(ctx, n, msg, att...)
+		if err != nil {
+			chRes = &Result{Channel: channel}
+			for _, addr := range addresses {
+				chRes.Add(addr, "", err)
+			}
+		}
+		for _, d := range chRes.Deliveries {
+			for _, recipient := range recipients[d.Address] {
+				o := outcomes[recipient]
+				o.channel = channel
+				if d.OK() {
+					o.sent, o.messageID = true, d.MessageID
+					continue
+				}
+				o.errs = append(o.errs, &ChannelError{Channel: channel, Addresses: []string{d.Address}, Err: d.Err})
+			}
+		}
+
+		next := pending[:0]
+		for _, recipient := range pending {
+			if !outcomes[recipient].sent {
+				next = append(next, recipient)
+			}
+		}
+		pending = next
+	}
+
+	res := &Result{Channel: f.String()}
+	for _, recipient := range message.Addresses {
+		o, ok := outcomes[recipient]
+		if !ok {
+			continue // duplicate
+		}
+		delete(outcomes, recipient)
+		d := Delivery{Address: recipient, Channel: o.channel}
+		switch {
+		case o.sent:
+			d.MessageID = o.messageID
+		case o.channel == "":
+			d.Err = ErrUnknownChannel
+			if ctx.Err() != nil {
+				d.Err = ctx.Err()
+			}
+		default:
+			d.Err = errors.Join(o.errs...)
+		}
+		res.Deliveries = append(res.Deliveries, d)
+	}
+	return res, nil
+}
@@ -0,0 +1,77 @@
+package notification_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+)
+
+func TestFallback_Send(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	bitrix := mock_notification.NewMockNotificator(ctrl)
+	bitrix.EXPECT().String().Return("bitrix").AnyTimes()
+	bitrix.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ interface{}, m notification.Message, _ ...notification.Attachment) error {
+			if len(m.Addresses) != 1 || m.Addresses[0] != "chat42" {
+				t.Errorf("bitrix got %v", m.Addresses)
+			}
+			return errors.New("portal is down")
+		})
+
+	telegram := mock_notification.NewMockNotificator(ctrl)
+	telegram.EXPECT().String().Return("telegram").AnyTimes()
+	telegram.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ interface{}, m notification.Message, _ ...notification.Attachment) error {
+			if len(m.Addresses) != 1 || m.Addresses[0] != "123456" {
+				t.Errorf("telegram got %v", m.Addresses)
+			}
+			return nil
+		})
+
+	email := mock_notification.NewMockNotificator(ctrl)
+	email.EXPECT().String().Return("email").AnyTimes()
+	email.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ interface{}, m notification.Message, _ ...notification.Attachment) error {
+			if len(m.Addresses) != 1 || m.Addresses[0] != "dev@example.com" {
+				t.Errorf("email got %v", m.Addresses)
+			}
+			return errors.New("mailbox unavailable")
+		})
+
+	f, err := notification.NewFallback(&notification.FallbackConfig{
+		Chain: []string{"bitrix", "telegram", "email"},
+		Addresses: map[string]map[string]string{
+			"oncall": {"bitrix": "chat42", "telegram": "123456"},
+			"dev":    {"email": "dev@example.com"},
+		},
+	}, email, telegram, bitrix)
+	if err != nil {
+		t.Fatalf("NewFallback() error = %v", err)
+	}
+
+	res, err := f.Send(context.Background(), notification.Message{Addresses: []string{"oncall", "dev"}})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(res.Deliveries) != 2 {
+		t.Fatalf("Send() deliveries = %+v", res.Deliveries)
+	}
+	if d := res.Deliveries[0]; d.Address != "oncall" || d.Channel != "telegram" || !d.OK() {
+		t.Errorf("Send() oncall = %+v, want delivered by telegram", d)
+	}
+	d := res.Deliveries[1]
+	var chErr *notification.ChannelError
+	if d.Address != "dev" || d.Channel != "email" || !errors.As(d.Err, &chErr) || chErr.Channel != "email" {
+		t.Errorf("Send() dev = %+v, want failed in email", d)
+	}
+
+	if _, err := notification.NewFallback(&notification.FallbackConfig{Chain: []string{"slack"}}, email); !errors.Is(err, notification.ErrUnknownChannel) {
+		t.Errorf("NewFallback() error = %v, want ErrUnknownChannel", err)
+	}
+}
@@ -0,0 +1,15 @@
+package notification
+
+// Format is the markup of the message content. Backends render it into
+// their own markup, see the render package.
+type Format string
+
+const (
+	// FormatDefault leaves the content as is: HTML for email and telegram,
+	// raw text for bitrix.
+	FormatDefault  Format = ""
+	FormatPlain    Format = "plain"
+	FormatHTML     Format = "html"
+	FormatMarkdown Format = "markdown"
+	FormatBBCode   Format = "bbcode"
+)
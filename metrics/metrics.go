@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+const defaultNamespace = "notification"
+
+type Config struct {
+	Namespace string `cfg:"namespace"`
+	// Buckets of the send duration histogram in seconds, prometheus.DefBuckets by default.
+	Buckets []float64 `cfg:"buckets"`
+}
+
+// Metrics is a prometheus.Collector of the notification metrics,
+// register it with the service registry:
+//
+//	m := metrics.NewMetrics(&metrics.Config{})
+//	prometheus.MustRegister(m)
+//	n := metrics.New(telegram.New(cfg), m)
+type Metrics struct {
+	sent     *prometheus.CounterVec
+	failed   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	retries  *prometheus.CounterVec
+	queue    *prometheus.Desc
+
+	mu     sync.Mutex
+	queues map[string]func() int
+}
+
+func NewMetrics(cfg *Config) *Metrics {
+	if cfg.Namespace == "" {
+		cfg.Namespace = defaultNamespace
+	}
+	if len(cfg.Buckets) == 0 {
+		cfg.Buckets = prometheus.DefBuckets
+	}
+	return &Metrics{
+		sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.Namespace,
+			Name:      "sent_total",
+			Help:      "Messages delivered, per address.",
+		}, []string{"channel"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.Namespace,
+			Name:      "failed_total",
+			Help:      "Messages failed, per address and error class.",
+		}, []string{"channel", "class"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.Namespace,
+			Name:      "send_duration_seconds",
+			Help:      "Duration of sending a message.",
+			Buckets:   cfg.Buckets,
+		}, []string{"channel"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.Namespace,
+			Name:      "retries_total",
+			Help:      "Addresses sent again after a retryable error.",
+		}, []string{"channel"}),
+		queue: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "", "queue_depth"),
+			"Messages waiting in the queue.",
+			[]string{"channel"}, nil,
+		),
+		queues: make(map[string]func() int),
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.sent.Describe(ch)
+	m.failed.Describe(ch)
+	m.duration.Describe(ch)
+	m.retries.Describe(ch)
+	ch <- m.queue
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.sent.Collect(ch)
+	m.failed.Collect(ch)
+	m.duration.Collect(ch)
+	m.retries.Collect(ch)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for channel, depth := range m.queues {
+		ch <- prometheus.MustNewConstMetric(m.queue, prometheus.GaugeValue, float64(depth()), channel)
+	}
+}
+
+// Queue reports the depth of a queue of the channel, e.g. outbox or digest,
+// depth is called on every scrape.
+func (m *Metrics) Queue(channel string, depth func() int) {
+	m.mu.Lock()
+	m.queues[channel] = depth
+	m.mu.Unlock()
+}
+
+// RetryHook returns the retry.Config OnRetry hook counting the retries of the channel.
+func (m *Metrics) RetryHook(channel string) func(attempt int, addresses []string) {
+	return func(_ int, addresses []string) {
+		m.retries.WithLabelValues(channel).Add(float64(len(addresses)))
+	}
+}
+
+// Observe records the result of sending a message.
+func (m *Metrics) Observe(channel string, res *notification.Result, elapsed time.Duration) {
+	m.duration.WithLabelValues(channel).Observe(elapsed.Seconds())
+	for _, d := range res.Deliveries {
+		if d.OK() {
+			m.sent.WithLabelValues(channel).Inc()
+		} else {
+			m.failed.WithLabelValues(channel, Class(d.Err)).Inc()
+		}
+	}
+}
+
+// Class returns the error class for the metric labels: the kind of
+// a *notification.SendError, "temporary" or "other".
+func Class(err error) string {
+	switch {
+	case errors.Is(err, notification.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, notification.ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, notification.ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, notification.ErrInvalidAddress):
+		return "invalid_address"
+	case errors.Is(err, notification.ErrNoAddresses):
+		return "no_addresses"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	}
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) && temporary.Temporary() {
+		return "temporary"
+	}
+	return "other"
+}
+
+// Notificator records the metrics of the messages sent through the wrapped notificator.
+type Notificator struct {
+	next    notification.Notificator
+	metrics *Metrics
+}
+
+func New(next notification.Notificator, metrics *Metrics) *Notificator {
+	return &Notificator{next, metrics}
+}
+
+func (n *Notificator) String() string {
+	return n.next.String()
+}
+
+func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	res, err := n.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	start := time.Now()
+	res, err := notification.Send(ctx, n.next, message, attachments...)
+	if err != nil {
+		n.metrics.duration.WithLabelValues(n.String()).Observe(time.Since(start).Seconds())
+		n.metrics.failed.WithLabelValues(n.String(), Class(err)).Inc()
+		return nil, err
+	}
+	n.metrics.Observe(n.String(), res, time.Since(start))
+	return res, nil
+}
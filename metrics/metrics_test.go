@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+)
+
+func TestNotificator_SendMessage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	next.EXPECT().String().Return("telegram").AnyTimes()
+	gomock.InOrder(
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(nil),
+		next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+			Return(notification.NewSendError("telegram", "", "429", notification.ErrRateLimited, errors.New("Too Many Requests"))),
+	)
+
+	m := NewMetrics(&Config{})
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(m); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	m.Queue("telegram", func() int { return 7 })
+	m.RetryHook("telegram")(1, []string{"3"})
+
+	n := New(next, m)
+	_ = n.SendMessage(notification.Message{Addresses: []string{"1", "2"}})
+	_ = n.SendMessage(notification.Message{Addresses: []string{"3"}})
+
+	want := `
+# HELP notification_failed_total Messages failed, per address and error class.
+# TYPE notification_failed_total counter
+notification_failed_total{channel="telegram",class="rate_limited"} 1
+# HELP notification_queue_depth Messages waiting in the queue.
+# TYPE notification_queue_depth gauge
+notification_queue_depth{channel="telegram"} 7
+# HELP notification_retries_total Addresses sent again after a retryable error.
+# TYPE notification_retries_total counter
+notification_retries_total{channel="telegram"} 1
+# HELP notification_sent_total Messages delivered, per address.
+# TYPE notification_sent_total counter
+notification_sent_total{channel="telegram"} 2
+`
+	err := testutil.GatherAndCompare(reg, strings.NewReader(want),
+		"notification_failed_total", "notification_queue_depth", "notification_retries_total", "notification_sent_total")
+	if err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(m, "notification_send_duration_seconds"); got != 1 {
+		t.Errorf("send_duration_seconds series = %d, want 1", got)
+	}
+}
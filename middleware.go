@@ -0,0 +1,179 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Middleware decorates a notificator, e.g. retry or a message rewrite.
+type Middleware func(Notificator) Notificator
+
+// Chain wraps n with the middlewares, the first one is the outermost:
+// Chain(n, a, b) sends through a, then b, then n.
+func Chain(n Notificator, middlewares ...Middleware) Notificator {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		n = middlewares[i](n)
+	}
+	return n
+}
+
+// MessageFunc returns a middleware changing every message with f before it's sent.
+func MessageFunc(f func(Message) (Message, error)) Middleware {
+	return func(next Notificator) Notificator {
+		return &messageFunc{next: next, f: f}
+	}
+}
+
+type messageFunc struct {
+	next Notificator
+	f    func(Message) (Message, error)
+}
+
+func (m *messageFunc) String() string {
+	return m.next.String()
+}
+
+func (m *messageFunc) SendMessage(message Message, attachments ...Attachment) error {
+	return m.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (m *messageFunc) SendMessageContext(ctx context.Context, message Message, attachments ...Attachment) error {
+	message, err := m.f(message)
+	if err != nil {
+		return err
+	}
+	return m.next.SendMessageContext(ctx, message, attachments...)
+}
+
+func (m *messageFunc) Send(ctx context.Context, message Message, attachments ...Attachment) (*Result, error) {
+	message, err := m.f(message)
+	if err != nil {
+		return nil, err
+	}
+	return Send(ctx, m.next, message, attachments...)
+}
+
+// SubjectPrefix prepends the prefix to the subject.
+func SubjectPrefix(prefix string) Middleware {
+	return MessageFunc(func(message Message) (Message, error) {
+		if !strings.HasPrefix(message.Subject, prefix) {
+			message.Subject = strings.TrimSpace(prefix + " " + message.Subject)
+		}
+		return message, nil
+	})
+}
+
+// Environment tags the subject with the environment, e.g. "[staging] Disk full".
+func Environment(env string) Middleware {
+	return SubjectPrefix("[" + env + "]")
+}
+
+// RewriteRecipients replaces the addresses by the rules: an address maps to
+// the addresses it is sent to instead, an empty list drops it. The "*" rule
+// is used for the addresses without a rule, e.g. to redirect everything to
+// a test chat in staging.
+func RewriteRecipients(rules map[string][]string) Middleware {
+	return MessageFunc(func(message Message) (Message, error) {
+		var addresses []string
+		seen := make(map[string]bool)
+		for _, addr := range message.Addresses {
+			to, ok := rules[addr]
+			if !ok {
+				to, ok = rules["*"]
+			}
+			if !ok {
+				to = []string{addr}
+			}
+			for _, a := range to {
+				if !seen[a] {
+					seen[a] = true
+					addresses = append(addresses, a)
+				}
+			}
+		}
+		if len(addresses) == 0 {
+			return message, ErrNoAddresses
+		}
+		message.Addresses = addresses
+		return message, nil
+	})
+}
+
+// RedactContent replaces the matches of the regular expressions in the
+// subject and content with "***", e.g. passwords in the logged errors.
+// Only the group named keep is kept, so `(?P<keep>password=)\S+` keeps
+// the key; the other groups are replaced with the rest of the match.
+func RedactContent(patterns ...string) (Middleware, error) {
+	var (
+		res       []*regexp.Regexp
+		templates []string
+	)
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("redact %q: %w", p, err)
+		}
+		template := "***"
+		if re.SubexpIndex("keep") >= 0 {
+			template = "${keep}***"
+		}
+		res = append(res, re)
+		templates = append(templates, template)
+	}
+	redact := func(s string) string {
+		for i, re := range res {
+			s = re.ReplaceAllString(s, templates[i])
+		}
+		return s
+	}
+	return MessageFunc(func(message Message) (Message, error) {
+		message.Subject = redact(message.Subject)
+		if message.Content != nil {
+			body, err := io.ReadAll(message.Content)
+			if err != nil {
+				return message, err
+			}
+			message.Content = bytes.NewReader([]byte(redact(string(body))))
+		}
+		return message, nil
+	}), nil
+}
+
+// MiddlewareConfig is the `middleware:` section of the config,
+// applied to every backend by Load.
+type MiddlewareConfig struct {
+	Environment   string `cfg:"environment"`
+	SubjectPrefix string `cfg:"subject_prefix"`
+	// Rewrite are the RewriteRecipients rules per channel, the addresses
+	// differ between the backends: {"telegram": {"*": ["-100123"]}}.
+	Rewrite map[string]map[string][]string `cfg:"rewrite"`
+	Redact  []string                       `cfg:"redact"`
+}
+
+// Middlewares returns the middlewares of the channel: recipients are
+// rewritten first, then the content redacted and the subject prefixed
+// and tagged, e.g. "[prod] [billing] Disk full".
+func (c *MiddlewareConfig) Middlewares(channel string) ([]Middleware, error) {
+	var middlewares []Middleware
+	if rules := c.Rewrite[channel]; len(rules) > 0 {
+		middlewares = append(middlewares, RewriteRecipients(rules))
+	}
+	if len(c.Redact) > 0 {
+		redact, err := RedactContent(c.Redact...)
+		if err != nil {
+			return nil, err
+		}
+		middlewares = append(middlewares, redact)
+	}
+	if c.SubjectPrefix != "" {
+		middlewares = append(middlewares, SubjectPrefix(c.SubjectPrefix))
+	}
+	if c.Environment != "" {
+		middlewares = append(middlewares, Environment(c.Environment))
+	}
+	return middlewares, nil
+}
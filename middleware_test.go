@@ -0,0 +1,150 @@
+package notification_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) notification.Middleware {
+		return notification.MessageFunc(func(m notification.Message) (notification.Message, error) {
+			order = append(order, name)
+			return m, nil
+		})
+	}
+
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	next.EXPECT().String().Return("telegram").AnyTimes()
+	next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(nil)
+
+	n := notification.Chain(next, mw("a"), mw("b"))
+	if got := n.String(); got != "telegram" {
+		t.Errorf("String() = %q, want telegram", got)
+	}
+	if err := n.SendMessage(notification.Message{Addresses: []string{"1"}}); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+func TestMiddlewareConfig_Middlewares(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         notification.MiddlewareConfig
+		message     notification.Message
+		wantSubject string
+		wantContent string
+		wantAddrs   []string
+		wantErr     error
+	}{
+		{
+			name:        "префикс и окружение",
+			cfg:         notification.MiddlewareConfig{Environment: "prod", SubjectPrefix: "[billing]"},
+			message:     notification.Message{Subject: "Disk full", Addresses: []string{"1"}},
+			wantSubject: "[prod] [billing] Disk full",
+			wantAddrs:   []string{"1"},
+		},
+		{
+			name: "перенаправление адресов",
+			cfg: notification.MiddlewareConfig{Rewrite: map[string]map[string][]string{
+				"telegram": {
+					"ops": {"1", "2"},
+					"*":   {"2"},
+				},
+				"email": {"*": {"qa@example.com"}},
+			}},
+			message:   notification.Message{Addresses: []string{"ops", "dev"}},
+			wantAddrs: []string{"1", "2"},
+		},
+		{
+			name:    "все адреса удалены",
+			cfg:     notification.MiddlewareConfig{Rewrite: map[string]map[string][]string{"telegram": {"*": nil}}},
+			message: notification.Message{Addresses: []string{"ops"}},
+			wantErr: notification.ErrNoAddresses,
+		},
+		{
+			name: "скрытие паролей",
+			cfg:  notification.MiddlewareConfig{Redact: []string{`(?P<keep>password=)\S+`, `\d{16}`}},
+			message: notification.Message{
+				Subject:   "login password=secret",
+				Content:   strings.NewReader("card 1234567812345678, password=qwerty"),
+				Addresses: []string{"1"},
+			},
+			wantSubject: "login password=***",
+			wantContent: "card ***, password=***",
+			wantAddrs:   []string{"1"},
+		},
+		{
+			name:        "пароль в группе",
+			cfg:         notification.MiddlewareConfig{Redact: []string{`password=(\S+)`}},
+			message:     notification.Message{Subject: "login password=secret", Addresses: []string{"1"}},
+			wantSubject: "login ***",
+			wantAddrs:   []string{"1"},
+		},
+		{
+			name:        "совпадение не на границе слова",
+			cfg:         notification.MiddlewareConfig{Redact: []string{`\Bsecret`}},
+			message:     notification.Message{Subject: "mysecret", Addresses: []string{"1"}},
+			wantSubject: "my***",
+			wantAddrs:   []string{"1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middlewares, err := tt.cfg.Middlewares("telegram")
+			if err != nil {
+				t.Fatalf("Middlewares() error = %v", err)
+			}
+
+			ctrl := gomock.NewController(t)
+			next := mock_notification.NewMockNotificator(ctrl)
+			next.EXPECT().String().Return("telegram").AnyTimes()
+			var got notification.Message
+			next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, m notification.Message, _ ...notification.Attachment) error {
+					got = m
+					return nil
+				}).MaxTimes(1)
+
+			err = notification.Chain(next, middlewares...).SendMessage(tt.message)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SendMessage() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", got.Subject, tt.wantSubject)
+			}
+			if !reflect.DeepEqual(got.Addresses, tt.wantAddrs) {
+				t.Errorf("Addresses = %v, want %v", got.Addresses, tt.wantAddrs)
+			}
+			if got.Content != nil {
+				body, _ := io.ReadAll(got.Content)
+				if string(body) != tt.wantContent {
+					t.Errorf("Content = %q, want %q", body, tt.wantContent)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareConfig_InvalidRedact(t *testing.T) {
+	cfg := notification.MiddlewareConfig{Redact: []string{"("}}
+	if _, err := cfg.Middlewares("telegram"); err == nil {
+		t.Error("Middlewares() error = nil, want invalid regexp")
+	}
+}
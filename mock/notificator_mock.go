@@ -5,6 +5,7 @@
 package mock_notification
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -53,6 +54,25 @@ func (mr *MockNotificatorMockRecorder) SendMessage(arg0 interface{}, arg1 ...int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockNotificator)(nil).SendMessage), varargs...)
 }
 
+// SendMessageContext mocks base method.
+func (m *MockNotificator) SendMessageContext(arg0 context.Context, arg1 notification.Message, arg2 ...notification.Attachment) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "SendMessageContext", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendMessageContext indicates an expected call of SendMessageContext.
+func (mr *MockNotificatorMockRecorder) SendMessageContext(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessageContext", reflect.TypeOf((*MockNotificator)(nil).SendMessageContext), varargs...)
+}
+
 // String mocks base method.
 func (m *MockNotificator) String() string {
 	m.ctrl.T.Helper()
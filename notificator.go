@@ -1,10 +1,14 @@
 package notification
 
-import "io"
+import (
+	"context"
+	"io"
+)
 
 //go:generate mockgen -destination=mock/notificator_mock.go redits.oculeus.com/asorokin/notification Notificator
 type Notificator interface {
 	SendMessage(message Message, attachments ...Attachment) error
+	SendMessageContext(ctx context.Context, message Message, attachments ...Attachment) error
 	String() string
 }
 
@@ -12,6 +16,18 @@ type Message struct {
 	Addresses []string
 	Content   io.Reader
 	Subject   string
+	Format    Format
+	// Template is the name of the template rendering the content with Data,
+	// see the templates package.
+	Template string
+	Data     interface{}
+	// Severity is the level of the message, see Router.
+	Severity Severity
+	// Labels are matched by the Router rules, e.g. {"team": "billing"}.
+	Labels map[string]string
+	// Silent asks to deliver the message without a sound,
+	// e.g. telegram disable_notification; see the quiet package.
+	Silent bool
 }
 
 type Attachment struct {
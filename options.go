@@ -0,0 +1,65 @@
+package notification
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// Options are the common options of the notificator constructors.
+type Options struct {
+	Logger *slog.Logger
+}
+
+type Option func(*Options)
+
+// WithLogger logs the errors, retries and API responses with the logger;
+// nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// WithHandler is WithLogger for a slog.Handler.
+func WithHandler(handler slog.Handler) Option {
+	return WithLogger(slog.New(handler))
+}
+
+// NewOptions applies the options over the defaults.
+func NewOptions(opts ...Option) *Options {
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Logger == nil {
+		o.Logger = slog.New(discardHandler{})
+	}
+	return o
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// Redact replaces the secrets in s, e.g. the tokens in a request URL or in
+// the error of the HTTP client, so s can be logged.
+func Redact(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, "***")
+		}
+	}
+	return s
+}
+
+// Log attribute keys used by the notificators.
+const (
+	LogChannel   = "channel"
+	LogAddress   = "address"
+	LogMessageID = "message_id"
+	LogError     = "error"
+)
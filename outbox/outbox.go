@@ -0,0 +1,361 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"redits.oculeus.com/asorokin/notification"
+	"redits.oculeus.com/asorokin/notification/retry"
+)
+
+const (
+	defaultWorkers      = 1
+	defaultPollInterval = time.Second
+	defaultRetryDelay   = time.Minute
+	defaultMaxAttempts  = 10
+	recordExt           = ".json"
+	failedDir           = "failed"
+)
+
+// Notificator stores messages in a spool directory and delivers them
+// through the wrapped notificator in the background, see Run.
+// Messages left in the spool are delivered after a restart.
+type Notificator struct {
+	next     notification.Notificator
+	cfg      *Config
+	wake     chan struct{}
+	mu       sync.Mutex
+	inflight map[string]bool
+	// due keeps the NextAttempt of the records waiting for a retry,
+	// so scan doesn't read them until then.
+	due map[string]time.Time
+}
+
+type Config struct {
+	Dir          string        `cfg:"dir"`
+	Workers      int           `cfg:"workers"`
+	PollInterval time.Duration `cfg:"poll_interval"`
+	RetryDelay   time.Duration `cfg:"retry_delay"`
+	// MaxAttempts moves a message to the failed subdirectory after this many deliveries.
+	MaxAttempts int `cfg:"max_attempts"`
+	// OnError is called with the errors of updating the spool after a delivery
+	// and with the broken records moved to the failed subdirectory.
+	OnError func(err error) `cfg:"-"`
+}
+
+type record struct {
+	ID          string                 `json:"id"`
+	Envelope    *notification.Envelope `json:"envelope"`
+	Attempts    int                    `json:"attempts"`
+	Created     time.Time              `json:"created"`
+	NextAttempt time.Time              `json:"next_attempt"`
+	LastError   string                 `json:"last_error,omitempty"`
+}
+
+func New(next notification.Notificator, cfg *Config) *Notificator {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaultRetryDelay
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	return &Notificator{
+		next:     next,
+		cfg:      cfg,
+		wake:     make(chan struct{}, 1),
+		inflight: make(map[string]bool),
+		due:      make(map[string]time.Time),
+	}
+}
+
+func (n *Notificator) String() string {
+	return n.next.String()
+}
+
+func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+// SendMessageContext stores the message in the spool and returns;
+// the message is delivered by Run.
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	if len(message.Addresses) == 0 {
+		return notification.ErrNoAddresses
+	}
+	envelope, err := notification.NewEnvelope(message, attachments...)
+	if err != nil {
+		return err
+	}
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	rec := &record{
+		ID:          id,
+		Envelope:    envelope,
+		Created:     now,
+		NextAttempt: now,
+	}
+	if err := os.MkdirAll(n.cfg.Dir, 0o755); err != nil {
+		return err
+	}
+	if err := n.write(n.cfg.Dir, rec); err != nil {
+		return err
+	}
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Len returns the number of messages waiting in the spool.
+func (n *Notificator) Len() (int, error) {
+	names, err := n.list()
+	return len(names), err
+}
+
+// Run delivers the spooled messages with the workers until ctx is done.
+func (n *Notificator) Run(ctx context.Context) error {
+	if err := os.MkdirAll(filepath.Join(n.cfg.Dir, failedDir), 0o755); err != nil {
+		return err
+	}
+
+	jobs := make(chan *record)
+	var wg sync.WaitGroup
+	for i := 0; i < n.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range jobs {
+				n.deliver(ctx, rec)
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	ticker := time.NewTicker(n.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := n.scan(ctx, jobs); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-n.wake:
+		}
+	}
+}
+
+// scan hands the due records over to the workers, oldest first.
+func (n *Notificator) scan(ctx context.Context, jobs chan<- *record) error {
+	names, err := n.list()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range names {
+		n.mu.Lock()
+		busy := n.inflight[name]
+		next, known := n.due[name]
+		n.mu.Unlock()
+		if busy || known && next.After(now) {
+			continue
+		}
+		rec, err := n.read(name)
+		if err != nil {
+			// a broken record must not block the spool
+			n.report(fmt.Errorf("outbox: %w", err))
+			if err := os.Rename(filepath.Join(n.cfg.Dir, name), filepath.Join(n.cfg.Dir, failedDir, name)); err != nil {
+				n.report(fmt.Errorf("outbox: move broken %s to %s: %w", name, failedDir, err))
+			}
+			continue
+		}
+		n.mu.Lock()
+		if rec.NextAttempt.After(now) {
+			n.due[name] = rec.NextAttempt
+			n.mu.Unlock()
+			continue
+		}
+		n.inflight[name] = true
+		delete(n.due, name)
+		n.mu.Unlock()
+		select {
+		case jobs <- rec:
+		case <-ctx.Done():
+			n.done(name)
+			return nil
+		}
+	}
+	return nil
+}
+
+// deliver sends the record and removes it from the spool, keeps the
+// addresses failed with a retryable error for the next attempt and
+// moves the rest of the failed ones to the failed subdirectory.
+func (n *Notificator) deliver(ctx context.Context, rec *record) {
+	name := rec.ID + recordExt
+	defer n.done(name)
+
+	message, attachments := rec.Envelope.Open()
+	res, err := notification.Send(ctx, n.next, message, attachments...)
+	if ctx.Err() != nil {
+		return // stays in the spool until the next start
+	}
+	if err != nil {
+		res = &notification.Result{Channel: n.String()}
+		for _, addr := range message.Addresses {
+			res.Add(addr, "", err)
+		}
+	}
+
+	var retryable, permanent []string
+	for _, d := range res.Failed() {
+		if ok, _ := retry.Classify(d.Err); ok && rec.Attempts+1 < n.cfg.MaxAttempts {
+			retryable = append(retryable, d.Address)
+		} else {
+			permanent = append(permanent, d.Address)
+		}
+	}
+	rec.Attempts++
+	if failed := res.Err(); failed != nil {
+		rec.LastError = failed.Error()
+	} else if err != nil {
+		rec.LastError = err.Error()
+	}
+
+	if len(permanent) > 0 {
+		dead := *rec
+		dead.Envelope = withAddresses(rec.Envelope, permanent)
+		if err := n.write(filepath.Join(n.cfg.Dir, failedDir), &dead); err != nil {
+			// keep them in the spool rather than lose them
+			n.report(fmt.Errorf("outbox: move %s to %s: %w", rec.ID, failedDir, err))
+			retryable = append(retryable, permanent...)
+		}
+	}
+	if len(retryable) == 0 {
+		if err := os.Remove(filepath.Join(n.cfg.Dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			n.report(fmt.Errorf("outbox: remove delivered %s: %w", rec.ID, err))
+		}
+		return
+	}
+	rec.Envelope = withAddresses(rec.Envelope, retryable)
+	rec.NextAttempt = time.Now().Add(n.cfg.RetryDelay)
+	if err := n.write(n.cfg.Dir, rec); err != nil {
+		// the old record is sent again to all its addresses
+		n.report(fmt.Errorf("outbox: save %s for retry: %w", rec.ID, err))
+		return
+	}
+	n.mu.Lock()
+	n.due[name] = rec.NextAttempt
+	n.mu.Unlock()
+}
+
+func (n *Notificator) report(err error) {
+	if n.cfg.OnError != nil {
+		n.cfg.OnError(err)
+	}
+}
+
+func (n *Notificator) done(name string) {
+	n.mu.Lock()
+	delete(n.inflight, name)
+	n.mu.Unlock()
+}
+
+func (n *Notificator) list() ([]string, error) {
+	entries, err := os.ReadDir(n.cfg.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), recordExt) {
+			names = append(names, e.Name())
+		}
+	}
+	// ids start with the creation time
+	sort.Strings(names)
+	return names, nil
+}
+
+func (n *Notificator) read(name string) (*record, error) {
+	data, err := os.ReadFile(filepath.Join(n.cfg.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	rec := &record{}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", name, err)
+	}
+	if rec.Envelope == nil {
+		return nil, fmt.Errorf("decode %s: no envelope", name)
+	}
+	return rec, nil
+}
+
+// write saves the record atomically through a temporary file.
+func (n *Notificator) write(dir string, rec *record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, rec.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, rec.ID+recordExt))
+}
+
+func withAddresses(e *notification.Envelope, addresses []string) *notification.Envelope {
+	c := *e
+	c.Message.Addresses = addresses
+	return &c
+}
+
+func newID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%020d-%s", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
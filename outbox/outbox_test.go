@@ -0,0 +1,181 @@
+package outbox
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+	"redits.oculeus.com/asorokin/notification/telegram"
+)
+
+func TestNotificator_Run(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	next.EXPECT().String().Return("telegram").AnyTimes()
+
+	delivered := make(chan string, 2)
+	next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Times(2).
+		DoAndReturn(func(_ interface{}, m notification.Message, _ ...notification.Attachment) error {
+			body, _ := io.ReadAll(m.Content)
+			delivered <- string(body)
+			if m.Addresses[0] == "1" {
+				return &telegram.APIError{Code: 400, Description: "Bad Request: chat not found"}
+			}
+			return nil
+		})
+
+	cfg := &Config{Dir: t.TempDir(), PollInterval: 10 * time.Millisecond}
+	// сообщение, сохранённое до запуска, доставляется после старта
+	if err := New(next, cfg).SendMessage(notification.Message{
+		Addresses: []string{"1"},
+		Content:   strings.NewReader("before start"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := New(next, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	if err := n.SendMessage(notification.Message{
+		Addresses: []string{"2"},
+		Content:   strings.NewReader("after start"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"before start", "after start"} {
+		select {
+		case got := <-delivered:
+			if got != want {
+				t.Errorf("delivered %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q not delivered", want)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		l, err := n.Len()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Len() = %d, want 0", l)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	failed, err := New(next, &Config{Dir: cfg.Dir + "/" + failedDir}).Len()
+	if err != nil || failed != 1 {
+		t.Errorf("failed Len() = %d, %v, want 1", failed, err)
+	}
+}
+
+func TestNotificator_deliverWriteFailed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	next.EXPECT().String().Return("telegram").AnyTimes()
+	next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+		Return(&telegram.APIError{Code: 400, Description: "Bad Request: chat not found"})
+
+	var errs []error
+	// без Run подкаталог failed не создан, перенос в него не удаётся
+	n := New(next, &Config{Dir: t.TempDir(), OnError: func(err error) { errs = append(errs, err) }})
+	if err := n.SendMessage(notification.Message{
+		Addresses: []string{"1"},
+		Content:   strings.NewReader("lost?"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	names, err := n.list()
+	if err != nil || len(names) != 1 {
+		t.Fatalf("list() = %v, %v", names, err)
+	}
+	rec, err := n.read(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.deliver(context.Background(), rec)
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "move") {
+		t.Errorf("OnError got %v, want the failed move", errs)
+	}
+	rec, err = n.read(names[0])
+	if err != nil {
+		t.Fatalf("the message is lost: %v", err)
+	}
+	if got := rec.Envelope.Message.Addresses; len(got) != 1 || got[0] != "1" || rec.Attempts != 1 {
+		t.Errorf("record = %v attempts %d, want [1] after 1 attempt", got, rec.Attempts)
+	}
+}
+
+func TestNotificator_scanBroken(t *testing.T) {
+	var errs []error
+	cfg := &Config{Dir: t.TempDir(), OnError: func(err error) { errs = append(errs, err) }}
+	n := New(nil, cfg)
+	broken := filepath.Join(cfg.Dir, "broken"+recordExt)
+	if err := os.WriteFile(broken, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the failed subdirectory is created by Run
+	if err := n.scan(context.Background(), nil); err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+	if len(errs) != 2 || !strings.Contains(errs[1].Error(), "move broken") {
+		t.Fatalf("OnError() got %v, want the broken record and the failed move", errs)
+	}
+
+	if err := os.Mkdir(filepath.Join(cfg.Dir, failedDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.scan(context.Background(), nil); err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+	if len(errs) != 3 {
+		t.Errorf("OnError() got %v, want the broken record reported again", errs)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.Dir, failedDir, "broken"+recordExt)); err != nil {
+		t.Errorf("broken record isn't moved: %v", err)
+	}
+}
+
+func TestNotificator_scanNotDue(t *testing.T) {
+	var errs []error
+	cfg := &Config{Dir: t.TempDir(), OnError: func(err error) { errs = append(errs, err) }}
+	n := New(nil, cfg)
+	rec := &record{
+		ID:          "later",
+		Envelope:    &notification.Envelope{},
+		NextAttempt: time.Now().Add(time.Hour),
+	}
+	if err := n.write(cfg.Dir, rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.scan(context.Background(), nil); err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+
+	// the record isn't read again until its next attempt
+	if err := os.WriteFile(filepath.Join(cfg.Dir, rec.ID+recordExt), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.scan(context.Background(), nil); err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("OnError() got %v, want the record skipped", errs)
+	}
+}
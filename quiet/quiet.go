@@ -0,0 +1,308 @@
+package quiet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+const defaultSendTimeout = 30 * time.Second
+
+// Window is the quiet hours, e.g. from "22:00" to "08:00" in "Europe/Moscow".
+type Window struct {
+	// Start and End are the times of day, the window may cross midnight.
+	Start string `cfg:"start"`
+	End   string `cfg:"end"`
+	// TimeZone is the IANA zone of the times, local by default.
+	TimeZone string `cfg:"time_zone"`
+	// Addresses limit the window to the recipients, all by default.
+	Addresses []string `cfg:"addresses"`
+	// Labels limit the window to the messages with the labels,
+	// e.g. the ones a route of the Router matches.
+	Labels map[string]string `cfg:"labels"`
+}
+
+type Config struct {
+	Windows []Window `cfg:"windows"`
+	// Severity is the lowest severity sent in the quiet hours, warning by
+	// default; a message without a level counts as info.
+	Severity notification.Severity `cfg:"severity"`
+	// Silent sends the messages at once without a sound, e.g. telegram
+	// disable_notification, instead of holding them to the window end.
+	Silent bool `cfg:"silent"`
+	// OnError is called with the errors of the held messages sent in the background.
+	OnError func(err error) `cfg:"-"`
+}
+
+// window is a Window with the parsed times.
+type window struct {
+	start, end time.Duration // since midnight
+	loc        *time.Location
+	addresses  map[string]bool
+	labels     map[string]string
+}
+
+// Notificator holds the messages below the severity to the recipients in
+// their quiet hours and sends them when the window ends, or sends them
+// silently, see Config.Silent. Each held message is sent on its own,
+// wrap a digest notificator to get one message in the morning.
+type Notificator struct {
+	next    notification.Notificator
+	cfg     *Config
+	windows []*window
+	now     func() time.Time
+	mu      sync.Mutex
+	held    map[*held]bool
+}
+
+type held struct {
+	envelope  *notification.Envelope
+	addresses []string
+	timer     *time.Timer
+}
+
+func New(next notification.Notificator, cfg *Config) (*Notificator, error) {
+	if cfg.Severity == notification.SeverityDefault {
+		cfg.Severity = notification.SeverityWarning
+	}
+	n := &Notificator{
+		next: next,
+		cfg:  cfg,
+		now:  time.Now,
+		held: make(map[*held]bool),
+	}
+	for i, w := range cfg.Windows {
+		parsed, err := parseWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("quiet window %d: %w", i+1, err)
+		}
+		n.windows = append(n.windows, parsed)
+	}
+	return n, nil
+}
+
+func parseWindow(w Window) (*window, error) {
+	parsed := &window{loc: time.Local, labels: w.Labels}
+	var err error
+	if parsed.start, err = parseClock(w.Start); err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+	if parsed.end, err = parseClock(w.End); err != nil {
+		return nil, fmt.Errorf("end: %w", err)
+	}
+	if parsed.start == parsed.end {
+		return nil, errors.New("start equals end")
+	}
+	if w.TimeZone != "" {
+		if parsed.loc, err = time.LoadLocation(w.TimeZone); err != nil {
+			return nil, err
+		}
+	}
+	if len(w.Addresses) > 0 {
+		parsed.addresses = make(map[string]bool, len(w.Addresses))
+		for _, addr := range w.Addresses {
+			parsed.addresses[addr] = true
+		}
+	}
+	return parsed, nil
+}
+
+// parseClock parses a time of day like "22:00" into the duration since midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// until returns the end of the window if t is in it.
+func (w *window) until(t time.Time) (time.Time, bool) {
+	t = t.In(w.loc)
+	// the time of day, not the time since midnight: they differ on the DST change days
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	end := time.Date(t.Year(), t.Month(), t.Day(), int(w.end/time.Hour), int(w.end%time.Hour/time.Minute), 0, 0, w.loc)
+	switch {
+	case w.start < w.end:
+		return end, clock >= w.start && clock < w.end
+	case clock < w.end:
+		return end, true
+	case clock >= w.start:
+		return end.AddDate(0, 0, 1), true
+	}
+	return time.Time{}, false
+}
+
+func (w *window) match(message notification.Message, addr string) bool {
+	if w.addresses != nil && !w.addresses[addr] {
+		return false
+	}
+	for key, value := range w.labels {
+		if v, ok := message.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// quietUntil returns the latest end of the windows the recipient is in now.
+func (n *Notificator) quietUntil(message notification.Message, addr string, now time.Time) (time.Time, bool) {
+	var (
+		until time.Time
+		quiet bool
+	)
+	for _, w := range n.windows {
+		if !w.match(message, addr) {
+			continue
+		}
+		if end, ok := w.until(now); ok {
+			quiet = true
+			if end.After(until) {
+				until = end
+			}
+		}
+	}
+	return until, quiet
+}
+
+func (n *Notificator) String() string {
+	return n.next.String()
+}
+
+func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	res, err := n.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+// Send reports the held messages as delivered without a message id.
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	if len(message.Addresses) == 0 {
+		return nil, notification.ErrNoAddresses
+	}
+	if message.Severity.AtLeast(n.cfg.Severity) {
+		return notification.Send(ctx, n.next, message, attachments...)
+	}
+
+	now := n.now()
+	var (
+		loud, quiet []string
+		ends        []time.Time
+		byEnd       = make(map[time.Time][]string)
+	)
+	for _, addr := range message.Addresses {
+		until, ok := n.quietUntil(message, addr, now)
+		if !ok {
+			loud = append(loud, addr)
+			continue
+		}
+		quiet = append(quiet, addr)
+		until = until.UTC()
+		if _, ok := byEnd[until]; !ok {
+			ends = append(ends, until)
+		}
+		byEnd[until] = append(byEnd[until], addr)
+	}
+	if len(quiet) == 0 {
+		return notification.Send(ctx, n.next, message, attachments...)
+	}
+
+	envelope, err := notification.NewEnvelope(message, attachments...)
+	if err != nil {
+		return nil, err
+	}
+	res := &notification.Result{Channel: n.String()}
+	send := func(addresses []string, silent bool) {
+		msg, att := envelope.Open()
+		msg.Addresses = addresses
+		msg.Silent = msg.Silent || silent
+		sent, err := notification.Send(ctx, n.next, msg, att...)
+		if err != nil {
+			for _, addr := range addresses {
+				res.Add(addr, "", err)
+			}
+			return
+		}
+		res.Deliveries = append(res.Deliveries, sent.Deliveries...)
+	}
+	if len(loud) > 0 {
+		send(loud, false)
+	}
+	if n.cfg.Silent {
+		send(quiet, true)
+		return res, nil
+	}
+	for _, until := range ends {
+		n.hold(envelope, byEnd[until], until.Sub(now))
+		for _, addr := range byEnd[until] {
+			res.Add(addr, "", nil)
+		}
+	}
+	return res, nil
+}
+
+func (n *Notificator) hold(envelope *notification.Envelope, addresses []string, d time.Duration) {
+	h := &held{envelope: envelope, addresses: addresses}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	h.timer = time.AfterFunc(d, func() { n.release(h) })
+	n.held[h] = true
+}
+
+func (n *Notificator) release(h *held) {
+	n.mu.Lock()
+	if !n.held[h] {
+		n.mu.Unlock()
+		return
+	}
+	delete(n.held, h)
+	n.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSendTimeout)
+	defer cancel()
+	if err := n.send(ctx, h); err != nil && n.cfg.OnError != nil {
+		n.cfg.OnError(err)
+	}
+}
+
+func (n *Notificator) send(ctx context.Context, h *held) error {
+	message, attachments := h.envelope.Open()
+	message.Addresses = h.addresses
+	return n.next.SendMessageContext(ctx, message, attachments...)
+}
+
+// Len returns the number of held messages.
+func (n *Notificator) Len() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.held)
+}
+
+// Flush sends all the held messages now; call it before shutdown
+// so they aren't lost.
+func (n *Notificator) Flush(ctx context.Context) error {
+	n.mu.Lock()
+	all := n.held
+	n.held = make(map[*held]bool)
+	n.mu.Unlock()
+
+	var errs []error
+	for h := range all {
+		h.timer.Stop()
+		if err := n.send(ctx, h); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
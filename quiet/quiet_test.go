@@ -0,0 +1,209 @@
+package quiet
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+)
+
+func Test_window_until(t *testing.T) {
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2024, 3, day, hour, min, 0, 0, moscow)
+	}
+	// the clocks go from 02:00 to 03:00 in Berlin on 2024-03-31
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	dst := func(hour, min int) time.Time {
+		return time.Date(2024, 3, 31, hour, min, 0, 0, berlin)
+	}
+	tests := []struct {
+		name      string
+		window    Window
+		now       time.Time
+		want      time.Time
+		wantQuiet bool
+	}{
+		{
+			name:      "Ночь, до полуночи",
+			window:    Window{Start: "22:00", End: "08:00", TimeZone: "Europe/Moscow"},
+			now:       at(1, 23, 30),
+			want:      at(2, 8, 0),
+			wantQuiet: true,
+		},
+		{
+			name:      "Ночь, после полуночи",
+			window:    Window{Start: "22:00", End: "08:00", TimeZone: "Europe/Moscow"},
+			now:       at(2, 3, 0),
+			want:      at(2, 8, 0),
+			wantQuiet: true,
+		},
+		{
+			name:   "Ночь, днём",
+			window: Window{Start: "22:00", End: "08:00", TimeZone: "Europe/Moscow"},
+			now:    at(2, 12, 0),
+		},
+		{
+			name:      "Обед в другом поясе",
+			window:    Window{Start: "13:00", End: "14:00", TimeZone: "Asia/Novosibirsk"},
+			now:       at(2, 9, 30), // 13:30 in Novosibirsk
+			want:      at(2, 10, 0),
+			wantQuiet: true,
+		},
+		{
+			name:      "Переход на летнее время, в окне",
+			window:    Window{Start: "03:00", End: "04:00", TimeZone: "Europe/Berlin"},
+			now:       dst(3, 30),
+			want:      dst(4, 0),
+			wantQuiet: true,
+		},
+		{
+			name:   "Переход на летнее время, после окна",
+			window: Window{Start: "03:00", End: "04:00", TimeZone: "Europe/Berlin"},
+			now:    dst(4, 30),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := parseWindow(tt.window)
+			if err != nil {
+				t.Fatalf("parseWindow() error = %v", err)
+			}
+			got, quiet := w.until(tt.now)
+			if quiet != tt.wantQuiet || quiet && !got.Equal(tt.want) {
+				t.Errorf("until() = %v, %v, want %v, %v", got, quiet, tt.want, tt.wantQuiet)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, w := range []Window{
+		{Start: "25:00", End: "08:00"},
+		{Start: "08:00", End: "08:00"},
+		{Start: "22:00", End: "08:00", TimeZone: "Mars/Olympus"},
+	} {
+		if _, err := New(nil, &Config{Windows: []Window{w}}); err == nil {
+			t.Errorf("New(%+v) error = nil", w)
+		}
+	}
+}
+
+func TestNotificator_Send(t *testing.T) {
+	night := Window{Start: "22:00", End: "08:00", TimeZone: "Europe/Moscow", Addresses: []string{"1"}}
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+	now := time.Date(2024, 3, 1, 23, 30, 0, 0, moscow)
+
+	tests := []struct {
+		name       string
+		cfg        Config
+		severity   notification.Severity
+		wantSent   [][]string
+		wantSilent []bool
+		wantHeld   int
+	}{
+		{
+			name:       "Задержка до утра",
+			cfg:        Config{Windows: []Window{night}},
+			severity:   notification.SeverityInfo,
+			wantSent:   [][]string{{"2"}},
+			wantSilent: []bool{false},
+			wantHeld:   1,
+		},
+		{
+			name:       "Критическое сразу",
+			cfg:        Config{Windows: []Window{night}},
+			severity:   notification.SeverityCritical,
+			wantSent:   [][]string{{"1", "2"}},
+			wantSilent: []bool{false},
+		},
+		{
+			name:       "Без звука",
+			cfg:        Config{Windows: []Window{night}, Silent: true},
+			wantSent:   [][]string{{"2"}, {"1"}},
+			wantSilent: []bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			next := mock_notification.NewMockNotificator(ctrl)
+			next.EXPECT().String().Return("telegram").AnyTimes()
+			var (
+				sent   [][]string
+				silent []bool
+			)
+			next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).AnyTimes().
+				DoAndReturn(func(_ context.Context, m notification.Message, _ ...notification.Attachment) error {
+					sent = append(sent, m.Addresses)
+					silent = append(silent, m.Silent)
+					return nil
+				})
+
+			n, err := New(next, &tt.cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			n.now = func() time.Time { return now }
+			res, err := n.Send(context.Background(), notification.Message{
+				Addresses: []string{"1", "2"},
+				Content:   strings.NewReader("backup finished"),
+				Severity:  tt.severity,
+			})
+			if err != nil || res.Err() != nil || len(res.Deliveries) != 2 {
+				t.Fatalf("Send() = %+v, %v", res, err)
+			}
+			if !reflect.DeepEqual(sent, tt.wantSent) || !reflect.DeepEqual(silent, tt.wantSilent) {
+				t.Errorf("sent = %v silent = %v, want %v %v", sent, silent, tt.wantSent, tt.wantSilent)
+			}
+			if got := n.Len(); got != tt.wantHeld {
+				t.Errorf("Len() = %d, want %d", got, tt.wantHeld)
+			}
+
+			sent = nil
+			if err := n.Flush(context.Background()); err != nil {
+				t.Errorf("Flush() error = %v", err)
+			}
+			if tt.wantHeld > 0 && !reflect.DeepEqual(sent, [][]string{{"1"}}) {
+				t.Errorf("flushed = %v, want [[1]]", sent)
+			}
+		})
+	}
+}
+
+func TestNotificator_Release(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	released := make(chan notification.Message, 1)
+	next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, m notification.Message, _ ...notification.Attachment) error {
+			released <- m
+			return nil
+		})
+
+	n, err := New(next, &Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	envelope, _ := notification.NewEnvelope(notification.Message{Subject: "backup finished"})
+	n.hold(envelope, []string{"1"}, 10*time.Millisecond)
+
+	select {
+	case m := <-released:
+		if m.Subject != "backup finished" || !reflect.DeepEqual(m.Addresses, []string{"1"}) || m.Silent {
+			t.Errorf("released %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the held message wasn't sent at the window end")
+	}
+	if got := n.Len(); got != 0 {
+		t.Errorf("Len() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,262 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+const sweepEvery = 1000
+
+type Config struct {
+	// Rate is the number of messages per second for all addresses, 0 means no limit.
+	Rate  float64 `cfg:"rate"`
+	Burst int     `cfg:"burst"`
+	// AddressRate is the number of messages per second for one address, 0 means no limit.
+	AddressRate  float64 `cfg:"address_rate"`
+	AddressBurst int     `cfg:"address_burst"`
+	// MaxWait is how long a message may be queued, 0 means until the context is done.
+	MaxWait time.Duration `cfg:"max_wait"`
+}
+
+// LimitError is returned when a message would have to wait longer than MaxWait.
+type LimitError struct {
+	Address string
+	Delay   time.Duration
+}
+
+func (e *LimitError) Error() string {
+	if e.Address == "" {
+		return fmt.Sprintf("rate limit exceeded, retry in %s", e.Delay)
+	}
+	return fmt.Sprintf("rate limit exceeded for %s, retry in %s", e.Address, e.Delay)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == notification.ErrRateLimited
+}
+
+func (e *LimitError) Temporary() bool {
+	return true
+}
+
+func (e *LimitError) RetryAfter() time.Duration {
+	return e.Delay
+}
+
+// Bucket is a token bucket refilled with rate tokens per second up to burst.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	b := float64(burst)
+	if b < 1 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &Bucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+func (b *Bucket) advance(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// reserve takes a token and returns how long to wait for it.
+// Nothing is taken if the wait is longer than maxWait > 0.
+func (b *Bucket) reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(now)
+	wait := time.Duration(0)
+	if b.tokens < 1 {
+		wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+	if maxWait > 0 && wait > maxWait {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+func (b *Bucket) cancel() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
+
+func (b *Bucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(now)
+	return b.tokens >= b.burst
+}
+
+// Limiter limits messages for all addresses and for every address.
+// A nil *Limiter doesn't limit anything.
+type Limiter struct {
+	cfg       Config
+	global    *Bucket
+	mu        sync.Mutex
+	addresses map[string]*Bucket
+	calls     int
+}
+
+// NewLimiter returns nil if the config has no limits.
+func NewLimiter(cfg Config) *Limiter {
+	if cfg.Rate <= 0 && cfg.AddressRate <= 0 {
+		return nil
+	}
+	l := &Limiter{
+		cfg:       cfg,
+		addresses: make(map[string]*Bucket),
+	}
+	if cfg.Rate > 0 {
+		l.global = NewBucket(cfg.Rate, cfg.Burst)
+	}
+	return l
+}
+
+func (l *Limiter) address(address string) *Bucket {
+	if l.cfg.AddressRate <= 0 || address == "" {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// forget the buckets which are full again, so the map doesn't grow forever
+	if l.calls++; l.calls%sweepEvery == 0 {
+		now := time.Now()
+		for addr, b := range l.addresses {
+			if b.idle(now) {
+				delete(l.addresses, addr)
+			}
+		}
+	}
+	b, ok := l.addresses[address]
+	if !ok {
+		b = NewBucket(l.cfg.AddressRate, l.cfg.AddressBurst)
+		l.addresses[address] = b
+	}
+	return b
+}
+
+// Wait blocks until a message to the address is allowed by both the
+// address and the global limits, or fails with *LimitError if that
+// takes longer than MaxWait.
+func (l *Limiter) Wait(ctx context.Context, address string) error {
+	if l == nil {
+		return nil
+	}
+	return l.wait(ctx, address, l.address(address), l.global)
+}
+
+// WaitAddress is Wait for the address limit only, for backends which
+// take the global limit per API request.
+func (l *Limiter) WaitAddress(ctx context.Context, address string) error {
+	if l == nil {
+		return nil
+	}
+	return l.wait(ctx, address, l.address(address))
+}
+
+func (l *Limiter) wait(ctx context.Context, address string, buckets ...*Bucket) error {
+	now := time.Now()
+	var (
+		wait     time.Duration
+		reserved []*Bucket
+	)
+	release := func() {
+		for _, b := range reserved {
+			b.cancel()
+		}
+	}
+	for _, b := range buckets {
+		if b == nil {
+			continue
+		}
+		d, ok := b.reserve(now, l.cfg.MaxWait)
+		if !ok {
+			release()
+			return &LimitError{Address: address, Delay: d}
+		}
+		reserved = append(reserved, b)
+		if d > wait {
+			wait = d
+		}
+	}
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		release()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Notificator limits the messages sent through the wrapped notificator,
+// every address counts as a message.
+type Notificator struct {
+	next    notification.Notificator
+	limiter *Limiter
+}
+
+func New(next notification.Notificator, cfg *Config) *Notificator {
+	return &Notificator{next, NewLimiter(*cfg)}
+}
+
+func (n *Notificator) String() string {
+	return n.next.String()
+}
+
+func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	res, err := n.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+// Send waits for every address and sends the message to the allowed ones,
+// the others fail with *LimitError.
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	res := &notification.Result{Channel: n.String()}
+	var allowed []string
+	for _, addr := range message.Addresses {
+		if err := n.limiter.Wait(ctx, addr); err != nil {
+			res.Add(addr, "", err)
+			continue
+		}
+		allowed = append(allowed, addr)
+	}
+	if len(allowed) == 0 {
+		if len(res.Deliveries) == 0 {
+			return notification.Send(ctx, n.next, message, attachments...)
+		}
+		return res, nil
+	}
+
+	message.Addresses = allowed
+	sent, err := notification.Send(ctx, n.next, message, attachments...)
+	if err != nil {
+		return nil, err
+	}
+	res.Deliveries = append(res.Deliveries, sent.Deliveries...)
+	return res, nil
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Wait(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		addresses []string
+		wantErrs  int
+	}{
+		{
+			name:      "Без ограничений",
+			cfg:       Config{},
+			addresses: []string{"1", "1", "1", "1"},
+		},
+		{
+			name:      "Общий лимит в пределах burst",
+			cfg:       Config{Rate: 1, Burst: 3, MaxWait: time.Millisecond},
+			addresses: []string{"1", "2", "3"},
+		},
+		{
+			name:      "Общий лимит превышен",
+			cfg:       Config{Rate: 1, Burst: 2, MaxWait: time.Millisecond},
+			addresses: []string{"1", "2", "3", "4"},
+			wantErrs:  2,
+		},
+		{
+			name:      "Лимит адреса не влияет на другие адреса",
+			cfg:       Config{AddressRate: 1, AddressBurst: 1, MaxWait: time.Millisecond},
+			addresses: []string{"1", "2", "1", "2", "3"},
+			wantErrs:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.cfg)
+			errs := 0
+			for _, addr := range tt.addresses {
+				err := l.Wait(context.Background(), addr)
+				if err == nil {
+					continue
+				}
+				var limitErr *LimitError
+				if !errors.As(err, &limitErr) || limitErr.RetryAfter() <= 0 {
+					t.Errorf("Wait() error = %v, want *LimitError", err)
+				}
+				errs++
+			}
+			if errs != tt.wantErrs {
+				t.Errorf("Wait() errors = %d, want %d", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestLimiter_WaitDelay(t *testing.T) {
+	l := NewLimiter(Config{Rate: 50, Burst: 1})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background(), ""); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Wait() elapsed = %v, want at least 30ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l = NewLimiter(Config{Rate: 1, Burst: 1})
+	_ = l.Wait(ctx, "")
+	if err := l.Wait(ctx, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait() error = %v, want context.Canceled", err)
+	}
+}
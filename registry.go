@@ -0,0 +1,69 @@
+package notification
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Factory builds a notificator from its config section.
+// decode fills the backend config from the section using the `cfg` struct tags,
+// opts are the options given to Load.
+type Factory func(decode func(cfg interface{}) error, opts ...Option) (Notificator, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a notificator available by name (the same as its String()).
+// Backends call it from init, so a service only has to import them.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic("notification: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("notification: Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// Registered returns the sorted names of the registered notificators.
+func Registered() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func factory(name string) (Factory, bool) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	f, ok := factories[name]
+	return f, ok
+}
+
+// ConfigError reports required config fields that are not set.
+type ConfigError struct {
+	Notificator string
+	Fields      []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("notification: %s: missing required fields: %s", e.Notificator, strings.Join(e.Fields, ", "))
+}
+
+// MissingFields returns a *ConfigError for the given fields or nil if there are none.
+func MissingFields(name string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ConfigError{Notificator: name, Fields: fields}
+}
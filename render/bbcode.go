@@ -0,0 +1,32 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	bbSimple = strings.NewReplacer(
+		"[b]", "<b>", "[/b]", "</b>", "[B]", "<b>", "[/B]", "</b>",
+		"[i]", "<i>", "[/i]", "</i>", "[I]", "<i>", "[/I]", "</i>",
+		"[u]", "<u>", "[/u]", "</u>", "[U]", "<u>", "[/U]", "</u>",
+		"[s]", "<s>", "[/s]", "</s>", "[S]", "<s>", "[/S]", "</s>",
+		"[code]", "<pre>", "[/code]", "</pre>", "[CODE]", "<pre>", "[/CODE]", "</pre>",
+		"[quote]", "<blockquote>", "[/quote]", "</blockquote>",
+		"[QUOTE]", "<blockquote>", "[/QUOTE]", "</blockquote>",
+		"[br]", "<br>", "[BR]", "<br>",
+	)
+	bbURL      = regexp.MustCompile(`(?i)\[url=([^\]]+)\](.*?)\[/url\]`)
+	bbPlainURL = regexp.MustCompile(`(?i)\[url\](.*?)\[/url\]`)
+)
+
+// bbcodeToHTML converts the Bitrix BB-code tags into HTML, the unknown tags are dropped.
+func bbcodeToHTML(src string) string {
+	text := html.EscapeString(src)
+	text = bbURL.ReplaceAllString(text, `<a href="$1">$2</a>`)
+	text = bbPlainURL.ReplaceAllString(text, `<a href="$1">$1</a>`)
+	text = bbSimple.Replace(text)
+	text = bbTag.ReplaceAllString(text, "")
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
@@ -0,0 +1,139 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	mdBullet  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	mdNumber  = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	mdQuote   = regexp.MustCompile(`^>\s?(.*)$`)
+	mdRule    = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+
+	mdCode   = regexp.MustCompile("`([^`]+)`")
+	mdLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold   = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	mdItalic = regexp.MustCompile(`\*([^*\s][^*]*?)\*|\b_([^_\s][^_]*?)_\b`)
+	mdStrike = regexp.MustCompile(`~~(.+?)~~`)
+)
+
+// markdownToHTML converts the common subset of Markdown: headings, lists,
+// quotes, fenced code, paragraphs and inline emphasis, code and links.
+// Blocks are not separated by newlines, so the result renders the same
+// whether the line breaks are kept or not.
+func markdownToHTML(src string) string {
+	var (
+		b         strings.Builder
+		paragraph []string
+		list      string
+		quote     []string
+		code      []string
+		inCode    bool
+		lang      string
+	)
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + inline(strings.Join(paragraph, " ")) + "</p>")
+			paragraph = nil
+		}
+	}
+	flushList := func() {
+		if list != "" {
+			b.WriteString("</" + list + ">")
+			list = ""
+		}
+	}
+	flushQuote := func() {
+		if len(quote) > 0 {
+			b.WriteString("<blockquote>" + inline(strings.Join(quote, "<br>")) + "</blockquote>")
+			quote = nil
+		}
+	}
+	flush := func() {
+		flushParagraph()
+		flushList()
+		flushQuote()
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		if inCode {
+			if strings.HasPrefix(strings.TrimSpace(line), "```") {
+				class := ""
+				if lang != "" {
+					class = ` class="language-` + html.EscapeString(lang) + `"`
+				}
+				b.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+				inCode, code = false, nil
+				continue
+			}
+			code = append(code, line)
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			inCode, lang = true, strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+		case trimmed == "":
+			flush()
+		case mdRule.MatchString(line) && len(paragraph) == 0:
+			flush()
+			b.WriteString("<hr>")
+		case mdHeading.MatchString(line):
+			flush()
+			m := mdHeading.FindStringSubmatch(line)
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">")
+		case mdQuote.MatchString(line):
+			flushParagraph()
+			flushList()
+			quote = append(quote, mdQuote.FindStringSubmatch(line)[1])
+		case mdBullet.MatchString(line), mdNumber.MatchString(line):
+			flushParagraph()
+			flushQuote()
+			kind, m := "ul", mdBullet.FindStringSubmatch(line)
+			if m == nil {
+				kind, m = "ol", mdNumber.FindStringSubmatch(line)
+			}
+			if list != kind {
+				flushList()
+				b.WriteString("<" + kind + ">")
+				list = kind
+			}
+			b.WriteString("<li>" + inline(m[1]) + "</li>")
+		default:
+			flushList()
+			flushQuote()
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	if inCode {
+		b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+	}
+	flush()
+	return b.String()
+}
+
+// inline converts the inline Markdown of the text into HTML; code spans
+// are taken out first, so their content stays literal.
+func inline(text string) string {
+	var spans []string
+	text = mdCode.ReplaceAllStringFunc(text, func(s string) string {
+		spans = append(spans, "<code>"+html.EscapeString(mdCode.FindStringSubmatch(s)[1])+"</code>")
+		return "\x00" + strconv.Itoa(len(spans)-1) + "\x00"
+	})
+	text = html.EscapeString(text)
+	text = mdLink.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = mdBold.ReplaceAllString(text, "<b>$1$2</b>")
+	text = mdItalic.ReplaceAllString(text, "<i>$1$2</i>")
+	text = mdStrike.ReplaceAllString(text, "<s>$1</s>")
+	for i, span := range spans {
+		text = strings.Replace(text, "\x00"+strconv.Itoa(i)+"\x00", span, 1)
+	}
+	return text
+}
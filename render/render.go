@@ -0,0 +1,222 @@
+package render
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+// HTML renders the body as HTML, for email.
+func HTML(body string, from notification.Format) string {
+	switch from {
+	case notification.FormatPlain:
+		return strings.ReplaceAll(html.EscapeString(body), "\n", "<br>\n")
+	case notification.FormatMarkdown:
+		return markdownToHTML(body)
+	case notification.FormatBBCode:
+		return bbcodeToHTML(body)
+	}
+	return body
+}
+
+// TelegramHTML renders the body as the HTML subset supported by the Bot API.
+func TelegramHTML(body string, from notification.Format) string {
+	if from == notification.FormatPlain {
+		return html.EscapeString(body)
+	}
+	return convert(HTML(body, from), telegram)
+}
+
+// BBCode renders the body as BB-code for Bitrix.
+func BBCode(body string, from notification.Format) string {
+	switch from {
+	case notification.FormatPlain, notification.FormatBBCode:
+		return body
+	}
+	return convert(HTML(body, from), bbcode)
+}
+
+// Plain renders the body as plain text, for the text part of email.
+func Plain(body string, from notification.Format) string {
+	switch from {
+	case notification.FormatPlain:
+		return body
+	case notification.FormatBBCode:
+		return bbTag.ReplaceAllString(body, "")
+	}
+	return convert(HTML(body, from), plain)
+}
+
+// dialect describes how the inline HTML tags are written in the target markup.
+type dialect struct {
+	tags map[string][2]string
+	link func(href string) (open, close string)
+	text func(s string) string
+	// keepNewlines keeps the line breaks of the source text
+	keepNewlines bool
+}
+
+var telegram = &dialect{
+	tags: map[string][2]string{
+		"b": {"<b>", "</b>"}, "strong": {"<b>", "</b>"},
+		"i": {"<i>", "</i>"}, "em": {"<i>", "</i>"},
+		"u": {"<u>", "</u>"}, "ins": {"<u>", "</u>"},
+		"s": {"<s>", "</s>"}, "strike": {"<s>", "</s>"}, "del": {"<s>", "</s>"},
+		"code": {"<code>", "</code>"}, "pre": {"<pre>", "</pre>"},
+		"blockquote": {"<blockquote>", "</blockquote>"},
+		"tg-spoiler": {"<tg-spoiler>", "</tg-spoiler>"},
+	},
+	link: func(href string) (string, string) {
+		return `<a href="` + html.EscapeString(href) + `">`, "</a>"
+	},
+	text:         html.EscapeString,
+	keepNewlines: true,
+}
+
+var bbcode = &dialect{
+	tags: map[string][2]string{
+		"b": {"[B]", "[/B]"}, "strong": {"[B]", "[/B]"},
+		"i": {"[I]", "[/I]"}, "em": {"[I]", "[/I]"},
+		"u": {"[U]", "[/U]"}, "ins": {"[U]", "[/U]"},
+		"s": {"[S]", "[/S]"}, "strike": {"[S]", "[/S]"}, "del": {"[S]", "[/S]"},
+		"pre": {"[CODE]", "[/CODE]"},
+	},
+	link: func(href string) (string, string) {
+		return "[URL=" + href + "]", "[/URL]"
+	},
+	text: func(s string) string { return s },
+}
+
+var plain = &dialect{
+	link: func(href string) (string, string) {
+		return "", " (" + href + ")"
+	},
+	text: func(s string) string { return s },
+}
+
+var (
+	bbTag         = regexp.MustCompile(`(?i)\[/?(b|i|u|s|url|code|quote|color|size|user|chat|br)(=[^\]]*)?\]`)
+	extraNewlines = regexp.MustCompile(`\n{3,}`)
+	spaces        = regexp.MustCompile(`[ \t\r\n]+`)
+)
+
+// convert rewrites the HTML into the dialect: block tags become line breaks,
+// list items get bullets and unknown tags are dropped keeping their text.
+func convert(src string, d *dialect) string {
+	var (
+		b     strings.Builder
+		links []string
+		spans []string
+		pre   int
+	)
+	z := xhtml.NewTokenizer(strings.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+		tok := z.Token()
+		name := tok.Data
+		switch tt {
+		case xhtml.TextToken:
+			text := tok.Data
+			if !d.keepNewlines && pre == 0 {
+				text = spaces.ReplaceAllString(text, " ")
+				if out := b.String(); out == "" || strings.HasSuffix(out, "\n") {
+					text = strings.TrimLeft(text, " ")
+				}
+			}
+			b.WriteString(d.text(text))
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			switch {
+			case name == "br":
+				b.WriteString("\n")
+			case name == "li":
+				b.WriteString("• ")
+			case name == "a":
+				var href string
+				for _, a := range tok.Attr {
+					if a.Key == "href" {
+						href = a.Val
+					}
+				}
+				open, close := "", ""
+				if href != "" {
+					open, close = d.link(href)
+				}
+				b.WriteString(open)
+				links = append(links, close)
+			case heading(name):
+				b.WriteString(d.tags["b"][0])
+			case name == "pre":
+				pre++
+				b.WriteString(d.tags[name][0])
+			case name == "code" && pre > 0:
+				// the language class of <pre><code> isn't kept
+			case name == "span":
+				spoiler := d.tags["tg-spoiler"]
+				if !hasClass(tok, "tg-spoiler") {
+					spoiler = [2]string{}
+				}
+				b.WriteString(spoiler[0])
+				spans = append(spans, spoiler[1])
+			default:
+				b.WriteString(d.tags[name][0])
+			}
+		case xhtml.EndTagToken:
+			switch {
+			case name == "a":
+				if len(links) > 0 {
+					b.WriteString(links[len(links)-1])
+					links = links[:len(links)-1]
+				}
+			case name == "span":
+				if len(spans) > 0 {
+					b.WriteString(spans[len(spans)-1])
+					spans = spans[:len(spans)-1]
+				}
+			case heading(name):
+				b.WriteString(d.tags["b"][1] + "\n\n")
+			case name == "pre":
+				if pre > 0 {
+					pre--
+				}
+				b.WriteString(d.tags[name][1] + "\n")
+			case name == "code" && pre > 0:
+			case name == "p", name == "ul", name == "ol", name == "table":
+				b.WriteString("\n\n")
+			case name == "li", name == "div", name == "tr":
+				b.WriteString("\n")
+			case name == "td", name == "th":
+				b.WriteString("\t")
+			case name == "blockquote":
+				b.WriteString(d.tags[name][1] + "\n")
+			default:
+				b.WriteString(d.tags[name][1])
+			}
+		}
+	}
+	out := extraNewlines.ReplaceAllString(b.String(), "\n\n")
+	return strings.TrimSpace(out)
+}
+
+func heading(name string) bool {
+	return len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6'
+}
+
+func hasClass(tok xhtml.Token, class string) bool {
+	for _, a := range tok.Attr {
+		if a.Key == "class" {
+			for _, c := range strings.Fields(a.Val) {
+				if c == class {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package render
+
+import (
+	"testing"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+func TestRender(t *testing.T) {
+	const markdown = "# Отчёт\n\nОшибка в **ReporterWorker0**: `COPY` & [лог](https://logs.xyz/?a=1&b=2)\n\n- первая\n- вторая"
+	tests := []struct {
+		name   string
+		render func(string, notification.Format) string
+		body   string
+		from   notification.Format
+		want   string
+	}{
+		{
+			name:   "Markdown в HTML",
+			render: HTML,
+			body:   markdown,
+			from:   notification.FormatMarkdown,
+			want:   `<h1>Отчёт</h1><p>Ошибка в <b>ReporterWorker0</b>: <code>COPY</code> &amp; <a href="https://logs.xyz/?a=1&amp;b=2">лог</a></p><ul><li>первая</li><li>вторая</li></ul>`,
+		},
+		{
+			name:   "Markdown в HTML для Telegram",
+			render: TelegramHTML,
+			body:   markdown,
+			from:   notification.FormatMarkdown,
+			want:   "<b>Отчёт</b>\n\nОшибка в <b>ReporterWorker0</b>: <code>COPY</code> &amp; <a href=\"https://logs.xyz/?a=1&amp;b=2\">лог</a>\n\n• первая\n• вторая",
+		},
+		{
+			name:   "HTML в BB-код",
+			render: BBCode,
+			body:   `<p>pq: relation <b>"LpDestCountry"</b> does not exist</p><div>see <a href="https://logs.xyz">logs</a></div>`,
+			from:   notification.FormatHTML,
+			want:   "pq: relation [B]\"LpDestCountry\"[/B] does not exist\n\nsee [URL=https://logs.xyz]logs[/URL]",
+		},
+		{
+			name:   "HTML в текст",
+			render: Plain,
+			body:   "<h2>Status</h2>\n<p>duplicate key &lt;destid&gt;</p>",
+			from:   notification.FormatHTML,
+			want:   "Status\n\nduplicate key <destid>",
+		},
+		{
+			name:   "Неподдерживаемые теги Telegram удаляются",
+			render: TelegramHTML,
+			body:   `<table><tr><td>a</td><td>b</td></tr></table><span style="x">c</span><br>d`,
+			from:   notification.FormatHTML,
+			want:   "a\tb\t\n\nc\nd",
+		},
+		{
+			name:   "BB-код в текст",
+			render: Plain,
+			body:   "[B]ERROR[/B] [URL=https://logs.xyz]logs[/URL]",
+			from:   notification.FormatBBCode,
+			want:   "ERROR logs",
+		},
+		{
+			name:   "Текст в HTML",
+			render: HTML,
+			body:   "a < b\nc",
+			from:   notification.FormatPlain,
+			want:   "a &lt; b<br>\nc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.render(tt.body, tt.from); got != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Delivery is the result of sending a message to one address.
+// MessageID is the id given by the backend: Bitrix message id,
+// Telegram message_id or SMTP queue id; it may be empty.
+// Channel is set by the notificators sending through several channels,
+// e.g. Fallback: the channel which delivered the address or was tried last.
+type Delivery struct {
+	Address   string
+	Channel   string
+	MessageID string
+	Err       error
+}
+
+func (d Delivery) OK() bool {
+	return d.Err == nil
+}
+
+// Result lists the delivery of a message for every address.
+type Result struct {
+	Channel    string
+	Deliveries []Delivery
+}
+
+func (r *Result) Add(address, messageID string, err error) {
+	r.Deliveries = append(r.Deliveries, Delivery{
+		Address:   address,
+		MessageID: messageID,
+		Err:       err,
+	})
+}
+
+func (r *Result) Failed() []Delivery {
+	var failed []Delivery
+	for _, d := range r.Deliveries {
+		if !d.OK() {
+			failed = append(failed, d)
+		}
+	}
+	return failed
+}
+
+// Err returns a *ChannelError for the failed addresses or nil if all of them succeeded.
+func (r *Result) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	e := &ChannelError{Channel: r.Channel}
+	errs := make([]error, len(failed))
+	for i, d := range failed {
+		e.Addresses = append(e.Addresses, d.Address)
+		errs[i] = fmt.Errorf("%s: %w", d.Address, d.Err)
+	}
+	if len(failed) == 1 {
+		e.Err = failed[0].Err
+	} else {
+		e.Err = errors.Join(errs...)
+	}
+	return e
+}
+
+// ResultSender is implemented by notificators which report the delivery
+// of every address and keep sending after a failed one.
+// The error is returned only when nothing was sent at all.
+type ResultSender interface {
+	Send(ctx context.Context, message Message, attachments ...Attachment) (*Result, error)
+}
+
+// Send sends the message with n and returns the result for every address.
+// If n is not a ResultSender, its error is set for all the addresses.
+func Send(ctx context.Context, n Notificator, message Message, attachments ...Attachment) (*Result, error) {
+	if rs, ok := n.(ResultSender); ok {
+		return rs.Send(ctx, message, attachments...)
+	}
+	err := n.SendMessageContext(ctx, message, attachments...)
+	if err != nil && len(message.Addresses) == 0 {
+		return nil, err
+	}
+	res := &Result{Channel: n.String()}
+	for _, addr := range message.Addresses {
+		res.Add(addr, "", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,214 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net"
+	"net/textproto"
+	"time"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+const (
+	defaultAttempts   = 3
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = 30 * time.Second
+	defaultMultiplier = 2
+)
+
+// Notificator retries the addresses which failed with a retryable error.
+type Notificator struct {
+	next notification.Notificator
+	cfg  *Config
+	log  *slog.Logger
+}
+
+type Config struct {
+	Attempts   int           `cfg:"attempts"`
+	MinBackoff time.Duration `cfg:"min_backoff"`
+	MaxBackoff time.Duration `cfg:"max_backoff"`
+	Multiplier float64       `cfg:"multiplier"`
+	// Jitter randomizes the backoff by the fraction of it, from 0 to 1.
+	Jitter float64 `cfg:"jitter"`
+	// Classify reports whether the error is retryable and how long the
+	// server asked to wait, Classify by default.
+	Classify func(err error) (retry bool, after time.Duration) `cfg:"-"`
+	// OnRetry is called before the addresses are sent again, e.g. to count retries.
+	OnRetry func(attempt int, addresses []string) `cfg:"-"`
+}
+
+func New(next notification.Notificator, cfg *Config, opts ...notification.Option) *Notificator {
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = defaultAttempts
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultMinBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = defaultMultiplier
+	}
+	if cfg.Classify == nil {
+		cfg.Classify = Classify
+	}
+	o := notification.NewOptions(opts...)
+	return &Notificator{next, cfg, o.Logger.With(notification.LogChannel, next.String())}
+}
+
+func (n *Notificator) String() string {
+	return n.next.String()
+}
+
+func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	res, err := n.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+// Send sends the message and resends it to the addresses failed with a
+// retryable error until they succeed or the attempts run out. Only the
+// deliveries reported under a given address are resent: the others,
+// e.g. of a Router choosing the addresses itself, are returned as is.
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	if len(message.Addresses) == 0 {
+		return notification.Send(ctx, n.next, message, attachments...)
+	}
+	envelope, err := notification.NewEnvelope(message, attachments...)
+	if err != nil {
+		return nil, err
+	}
+
+	given := make(map[string]bool, len(message.Addresses))
+	for _, addr := range message.Addresses {
+		given[addr] = true
+	}
+	final := make(map[string]notification.Delivery, len(message.Addresses))
+	var order []string
+	pending := message.Addresses
+	for attempt := 1; len(pending) > 0; attempt++ {
+		msg, att := envelope.Open()
+		msg.Addresses = pending
+		res, err := notification.Send(ctx, n.next, msg, att...)
+		if err != nil {
+			if retry, _ := n.cfg.Classify(err); !retry || attempt >= n.cfg.Attempts || ctx.Err() != nil {
+				return nil, err
+			}
+			res = &notification.Result{}
+			for _, addr := range pending {
+				res.Add(addr, "", err)
+			}
+		}
+
+		pending = nil
+		var (
+			wait    time.Duration
+			lastErr error
+		)
+		for _, d := range res.Deliveries {
+			if _, ok := final[d.Address]; !ok {
+				order = append(order, d.Address)
+			}
+			final[d.Address] = d
+			if !given[d.Address] || d.OK() || attempt >= n.cfg.Attempts || ctx.Err() != nil {
+				continue
+			}
+			retry, after := n.cfg.Classify(d.Err)
+			if !retry {
+				continue
+			}
+			pending = append(pending, d.Address)
+			lastErr = d.Err
+			if after > wait {
+				wait = after
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		if backoff := n.backoff(attempt); backoff > wait {
+			wait = backoff
+		}
+		if n.cfg.OnRetry != nil {
+			n.cfg.OnRetry(attempt, pending)
+		}
+		n.log.InfoContext(ctx, "retrying", "attempt", attempt, "addresses", pending, "wait", wait,
+			notification.LogError, lastErr.Error())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			pending = nil
+		case <-timer.C:
+		}
+	}
+
+	res := &notification.Result{Channel: n.String()}
+	for _, addr := range order {
+		res.Deliveries = append(res.Deliveries, final[addr])
+	}
+	return res, nil
+}
+
+// backoff returns the delay after the attempt, growing exponentially with jitter.
+func (n *Notificator) backoff(attempt int) time.Duration {
+	d := float64(n.cfg.MinBackoff) * math.Pow(n.cfg.Multiplier, float64(attempt-1))
+	if d > float64(n.cfg.MaxBackoff) {
+		d = float64(n.cfg.MaxBackoff)
+	}
+	if n.cfg.Jitter > 0 {
+		d += d * n.cfg.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// Classify is the default classifier. Retryable are network errors,
+// SMTP 4xx replies and backend errors reporting Temporary, such as
+// Telegram 429 or Bitrix QUERY_LIMIT_EXCEEDED. A RetryAfter hint of
+// the error is returned as the delay.
+func Classify(err error) (retry bool, after time.Duration) {
+	// the caller's context is checked by Send, a deadline here is a backend timeout
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true, 0
+	}
+	var sendErr *notification.SendError
+	if errors.As(err, &sendErr) {
+		return sendErr.Temporary(), sendErr.RetryAfter()
+	}
+	var hint interface{ RetryAfter() time.Duration }
+	if errors.As(err, &hint) {
+		after = hint.RetryAfter()
+	}
+
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) {
+		if _, isNet := temporary.(net.Error); !isNet {
+			return temporary.Temporary(), after
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true, after
+	}
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500, after
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF), after
+}
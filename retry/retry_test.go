@@ -0,0 +1,136 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+	"redits.oculeus.com/asorokin/notification/telegram"
+)
+
+func TestNotificator_Send(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	next.EXPECT().String().Return("telegram").AnyTimes()
+
+	var calls [][]string
+	next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Times(3).
+		DoAndReturn(func(_ interface{}, m notification.Message, _ ...notification.Attachment) error {
+			calls = append(calls, m.Addresses)
+			switch len(calls) {
+			case 1:
+				return nil
+			case 2:
+				return &telegram.APIError{Code: 429, Description: "Too Many Requests"}
+			}
+			return &telegram.APIError{Code: 400, Description: "Bad Request: chat not found"}
+		})
+
+	n := New(next, &Config{Attempts: 3, MinBackoff: time.Millisecond})
+	// the mock isn't a ResultSender, so every call fails or passes for all addresses
+	if err := n.SendMessage(notification.Message{Addresses: []string{"1", "2"}}); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	err := n.SendMessage(notification.Message{Addresses: []string{"3"}})
+	var apiErr *telegram.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 400 {
+		t.Errorf("SendMessage() error = %v, want error 400", err)
+	}
+	if len(calls) != 3 {
+		t.Errorf("SendMessage() calls = %v", calls)
+	}
+}
+
+func TestNotificator_SendFallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tg := mock_notification.NewMockNotificator(ctrl)
+	tg.EXPECT().String().Return("telegram").AnyTimes()
+	email := mock_notification.NewMockNotificator(ctrl)
+	email.EXPECT().String().Return("email").AnyTimes()
+
+	limited := &telegram.APIError{Code: 429, Description: "Too Many Requests"}
+	gomock.InOrder(
+		tg.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(limited),
+		tg.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(nil),
+		tg.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(&telegram.APIError{Code: 403}),
+	)
+	email.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Times(2).Return(errors.New("mailbox unavailable"))
+
+	f, err := notification.NewFallback(&notification.FallbackConfig{}, tg, email)
+	if err != nil {
+		t.Fatalf("NewFallback() error = %v", err)
+	}
+	n := New(f, &Config{Attempts: 2, MinBackoff: time.Millisecond})
+
+	// every channel fails at first, the Telegram limit is retried
+	res, err := n.Send(context.Background(), notification.Message{Addresses: []string{"oncall"}})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(res.Deliveries) != 1 {
+		t.Fatalf("Send() deliveries = %+v", res.Deliveries)
+	}
+	if d := res.Deliveries[0]; d.Address != "oncall" || d.Channel != "telegram" || !d.OK() {
+		t.Errorf("Send() oncall = %+v, want delivered by telegram", d)
+	}
+
+	// every channel fails for good
+	if err := n.SendMessage(notification.Message{Addresses: []string{"oncall"}}); err == nil {
+		t.Error("SendMessage() error = nil, want the channel errors")
+	}
+}
+
+func TestNotificator_SendNoAddresses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	next := mock_notification.NewMockNotificator(ctrl)
+	next.EXPECT().String().Return("router").AnyTimes()
+	next.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).Return(nil)
+
+	// the wrapped notificator picks the addresses itself, e.g. a Router
+	if err := New(next, &Config{Attempts: 3}).SendMessage(notification.Message{Subject: "disk full"}); err != nil {
+		t.Errorf("SendMessage() error = %v", err)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantRetry bool
+	}{
+		{
+			name:      "Превышен лимит Telegram",
+			err:       &telegram.APIError{Code: 429},
+			wantRetry: true,
+		},
+		{
+			name: "Чат не найден",
+			err:  &telegram.APIError{Code: 400},
+		},
+		{
+			name: "Неизвестная ошибка",
+			err:  errors.New("unknown"),
+		},
+		{
+			name:      "Таймаут бэкенда",
+			err:       notification.NewSendError("email", "a@mail.xyz", "", nil, context.DeadlineExceeded),
+			wantRetry: true,
+		},
+		{
+			name: "Неверный адрес",
+			err:  notification.NewSendError("email", "a@mail.xyz", "550", notification.ErrInvalidAddress, errors.New("no such user")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := Classify(tt.err); got != tt.wantRetry {
+				t.Errorf("Classify() = %v, want %v", got, tt.wantRetry)
+			}
+		})
+	}
+}
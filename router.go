@@ -0,0 +1,106 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+)
+
+// Route is a rule of the Router: the messages of at least the severity
+// with all the labels are sent to the addresses.
+type Route struct {
+	Severity Severity          `cfg:"severity"`
+	Labels   map[string]string `cfg:"labels"`
+	// To are the addresses tagged with the channel, e.g. "telegram:123456",
+	// or the names of the directory, e.g. "oncall-db".
+	To []string `cfg:"to"`
+	// Continue checks the next rules after a match, by default the first
+	// matching rule wins.
+	Continue bool `cfg:"continue"`
+}
+
+func (r *Route) match(message Message) bool {
+	if !message.Severity.AtLeast(r.Severity) {
+		return false
+	}
+	for key, value := range r.Labels {
+		if v, ok := message.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Router sends a message to the channels and recipients picked by the
+// routes, e.g. critical to telegram and bitrix, warning to email.
+// The addresses of the message are sent as well.
+type Router struct {
+	dispatcher *Dispatcher
+	routes     []Route
+}
+
+func NewRouter(routes []Route, notificators ...Notificator) (*Router, error) {
+	d := NewDispatcher(notificators...)
+	for i, route := range routes {
+		for _, address := range route.To {
+			// the names of people and groups are resolved by the directory
+			channel, _, ok := SplitAddress(address)
+			if _, known := d.channels[channel]; ok && !known {
+				return nil, fmt.Errorf("route %d: %q: %w", i+1, address, ErrUnknownChannel)
+			}
+		}
+	}
+	return &Router{dispatcher: d, routes: routes}, nil
+}
+
+// WithDirectory resolves the names in the routes and the message
+// addresses with the directory, see Dispatcher.WithDirectory.
+func (r *Router) WithDirectory(dir Directory) *Router {
+	r.dispatcher.WithDirectory(dir)
+	return r
+}
+
+func (r *Router) String() string {
+	return "router"
+}
+
+// Route returns the message with the addresses of the matching routes added.
+func (r *Router) Route(message Message) Message {
+	seen := make(map[string]bool)
+	var addresses []string
+	add := func(address string) {
+		if !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+	for _, address := range message.Addresses {
+		add(address)
+	}
+	for i := range r.routes {
+		if !r.routes[i].match(message) {
+			continue
+		}
+		for _, address := range r.routes[i].To {
+			add(address)
+		}
+		if !r.routes[i].Continue {
+			break
+		}
+	}
+	message.Addresses = addresses
+	return message
+}
+
+func (r *Router) SendMessage(message Message, attachments ...Attachment) error {
+	return r.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (r *Router) SendMessageContext(ctx context.Context, message Message, attachments ...Attachment) error {
+	return r.dispatcher.SendMessageContext(ctx, r.Route(message), attachments...)
+}
+
+// Send sends the routed message through a Dispatcher,
+// the result addresses are tagged with the channel.
+func (r *Router) Send(ctx context.Context, message Message, attachments ...Attachment) (*Result, error) {
+	return r.dispatcher.Send(ctx, r.Route(message), attachments...)
+}
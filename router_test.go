@@ -0,0 +1,134 @@
+package notification_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"redits.oculeus.com/asorokin/notification"
+	mock_notification "redits.oculeus.com/asorokin/notification/mock"
+)
+
+func TestParseSeverity(t *testing.T) {
+	for _, name := range []string{"debug", "info", "warning", "error", "critical"} {
+		s, err := notification.ParseSeverity(name)
+		if err != nil || s.String() != name {
+			t.Errorf("ParseSeverity(%q) = %v, %v", name, s, err)
+		}
+	}
+	if s, _ := notification.ParseSeverity("warn"); s != notification.SeverityWarning {
+		t.Errorf("ParseSeverity(warn) = %v, want warning", s)
+	}
+	if _, err := notification.ParseSeverity("fatal"); err == nil {
+		t.Error("ParseSeverity(fatal) error = nil")
+	}
+}
+
+func TestRouter_Route(t *testing.T) {
+	routes := []notification.Route{
+		{
+			Severity: notification.SeverityCritical,
+			To:       []string{"telegram:100", "bitrix:chat42"},
+		},
+		{
+			Severity: notification.SeverityWarning,
+			Labels:   map[string]string{"team": "billing"},
+			To:       []string{"email:billing@example.com"},
+			Continue: true,
+		},
+		{
+			Severity: notification.SeverityWarning,
+			To:       []string{"email:ops@example.com"},
+		},
+	}
+	ctrl := gomock.NewController(t)
+	var notificators []notification.Notificator
+	for _, name := range []string{"telegram", "bitrix", "email"} {
+		n := mock_notification.NewMockNotificator(ctrl)
+		n.EXPECT().String().Return(name).AnyTimes()
+		notificators = append(notificators, n)
+	}
+	router, err := notification.NewRouter(routes, notificators...)
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		message notification.Message
+		want    []string
+	}{
+		{
+			name:    "Критическое",
+			message: notification.Message{Severity: notification.SeverityCritical},
+			want:    []string{"telegram:100", "bitrix:chat42"},
+		},
+		{
+			name: "Предупреждение с меткой",
+			message: notification.Message{
+				Severity: notification.SeverityWarning,
+				Labels:   map[string]string{"team": "billing"},
+			},
+			want: []string{"email:billing@example.com", "email:ops@example.com"},
+		},
+		{
+			name: "Ошибка и свои адреса",
+			message: notification.Message{
+				Severity:  notification.SeverityError,
+				Addresses: []string{"telegram:200", "email:ops@example.com"},
+			},
+			want: []string{"telegram:200", "email:ops@example.com"},
+		},
+		{
+			name:    "Без уровня",
+			message: notification.Message{},
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := router.Route(tt.message).Addresses; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Route() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouter_Send(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	telegram := mock_notification.NewMockNotificator(ctrl)
+	telegram.EXPECT().String().Return("telegram").AnyTimes()
+	telegram.EXPECT().SendMessageContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, m notification.Message, _ ...notification.Attachment) error {
+			if m.Severity != notification.SeverityCritical || !reflect.DeepEqual(m.Addresses, []string{"100"}) {
+				t.Errorf("telegram got %+v", m)
+			}
+			return nil
+		})
+
+	router, err := notification.NewRouter([]notification.Route{
+		{Severity: notification.SeverityCritical, To: []string{"telegram:100"}},
+	}, telegram)
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+	err = router.SendMessage(notification.Message{
+		Severity: notification.SeverityCritical,
+		Content:  strings.NewReader("database is down"),
+	})
+	if err != nil {
+		t.Errorf("SendMessage() error = %v", err)
+	}
+	if err := router.SendMessage(notification.Message{Severity: notification.SeverityInfo}); !errors.Is(err, notification.ErrNoAddresses) {
+		t.Errorf("SendMessage() error = %v, want %v", err, notification.ErrNoAddresses)
+	}
+
+	_, err = notification.NewRouter([]notification.Route{{To: []string{"slack:general"}}}, telegram)
+	if !errors.Is(err, notification.ErrUnknownChannel) {
+		t.Errorf("NewRouter() error = %v, want %v", err, notification.ErrUnknownChannel)
+	}
+}
@@ -0,0 +1,65 @@
+package notification
+
+import "fmt"
+
+// Severity is the level of a message. Backends reflect it, e.g. telegram
+// sends debug and info silently, and the Router picks the channels by it.
+type Severity int
+
+const (
+	// SeverityDefault is a message without a level: backends send it as
+	// before and it counts as info for the rules.
+	SeverityDefault Severity = iota
+	SeverityDebug
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+	SeverityCritical
+)
+
+var severityNames = [...]string{"", "debug", "info", "warning", "error", "critical"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// AtLeast reports whether the message of severity s is at least of the
+// min severity, a message without a level counts as info.
+func (s Severity) AtLeast(min Severity) bool {
+	if s == SeverityDefault {
+		s = SeverityInfo
+	}
+	return s >= min
+}
+
+// ParseSeverity parses the name of a severity, "warn" and "crit" are accepted too.
+func ParseSeverity(name string) (Severity, error) {
+	switch name {
+	case "warn":
+		return SeverityWarning, nil
+	case "crit":
+		return SeverityCritical, nil
+	}
+	for s, n := range severityNames {
+		if n == name {
+			return Severity(s), nil
+		}
+	}
+	return SeverityDefault, fmt.Errorf("unknown severity %q", name)
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	v, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
@@ -0,0 +1,219 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+const (
+	requestPhoto      = "sendPhoto"
+	requestDocument   = "sendDocument"
+	requestMediaGroup = "sendMediaGroup"
+	captionLimit      = 1024
+	mediaGroupLimit   = 10
+	photoSizeLimit    = 10 << 20
+)
+
+type file struct {
+	name        string
+	contentType string
+	content     []byte
+}
+
+// photo reports whether Telegram accepts the file as a photo,
+// other files are sent as documents.
+func (f file) photo() bool {
+	switch f.contentType {
+	case "image/jpeg", "image/png", "image/webp":
+		return len(f.content) <= photoSizeLimit
+	}
+	return false
+}
+
+func readFiles(attachments []notification.Attachment) ([]file, error) {
+	var files []file
+	for i, a := range attachments {
+		if a.Content == nil {
+			continue
+		}
+		content, err := io.ReadAll(a.Content)
+		if err != nil {
+			return nil, err
+		}
+		f := file{
+			name:        a.Filename,
+			contentType: a.ContentType,
+			content:     content,
+		}
+		if f.name == "" {
+			f.name = fmt.Sprintf("file%d", i+1)
+		}
+		if f.contentType == "" {
+			f.contentType = mime.TypeByExtension(filepath.Ext(f.name))
+		}
+		if f.contentType == "" {
+			f.contentType = http.DetectContentType(content)
+		}
+		if mediaType, _, err := mime.ParseMediaType(f.contentType); err == nil {
+			f.contentType = mediaType
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// sendWithFiles sends the files to the chat: photos and documents in
+// separate media groups of up to 10 files. The text becomes the caption
+// of the first file when it fits, otherwise it is sent before the files.
+// It returns the id of the first sent message.
+func (n *Notificator) sendWithFiles(ctx context.Context, chatid int, silent bool, text string, files []file) (string, error) {
+	var firstID string
+	caption := text
+	if utf8.RuneCountInString(text) > captionLimit {
+		id, err := n.sendText(ctx, chatid, silent, text)
+		if err != nil {
+			return "", err
+		}
+		firstID, caption = id, ""
+	}
+
+	var photos, documents []file
+	for _, f := range files {
+		if f.photo() {
+			photos = append(photos, f)
+		} else {
+			documents = append(documents, f)
+		}
+	}
+	for _, group := range [][]file{photos, documents} {
+		for len(group) > 0 {
+			size := len(group)
+			if size > mediaGroupLimit {
+				size = mediaGroupLimit
+			}
+			id, err := n.sendGroup(ctx, chatid, silent, caption, group[:size])
+			if err != nil {
+				return firstID, err
+			}
+			if firstID == "" {
+				firstID = id
+			}
+			caption = ""
+			group = group[size:]
+		}
+	}
+	return firstID, nil
+}
+
+func (n *Notificator) sendGroup(ctx context.Context, chatid int, silent bool, caption string, files []file) (string, error) {
+	if err := n.limiter.Wait(ctx, strconv.Itoa(chatid)); err != nil {
+		return "", err
+	}
+	fields := map[string]string{
+		"chat_id": strconv.Itoa(chatid),
+	}
+	if silent {
+		fields["disable_notification"] = "true"
+	}
+
+	if len(files) == 1 {
+		method, field := requestDocument, "document"
+		if files[0].photo() {
+			method, field = requestPhoto, "photo"
+		}
+		if caption != "" {
+			fields["caption"] = caption
+			fields["parse_mode"] = "html"
+		}
+		var sent struct {
+			MessageID int `json:"message_id"`
+		}
+		if err := n.upload(ctx, method, fields, map[string]file{field: files[0]}, &sent); err != nil {
+			return "", err
+		}
+		return strconv.Itoa(sent.MessageID), nil
+	}
+
+	type inputMedia struct {
+		Type      string `json:"type"`
+		Media     string `json:"media"`
+		Caption   string `json:"caption,omitempty"`
+		ParseMode string `json:"parse_mode,omitempty"`
+	}
+	media := make([]inputMedia, len(files))
+	parts := make(map[string]file, len(files))
+	for i, f := range files {
+		name := fmt.Sprintf("file%d", i)
+		media[i] = inputMedia{
+			Type:  "document",
+			Media: "attach://" + name,
+		}
+		if f.photo() {
+			media[i].Type = "photo"
+		}
+		parts[name] = f
+	}
+	if caption != "" {
+		media[0].Caption = caption
+		media[0].ParseMode = "html"
+	}
+	mediaJSON, err := json.Marshal(media)
+	if err != nil {
+		return "", fmt.Errorf("encode media JSON: %w", err)
+	}
+	fields["media"] = string(mediaJSON)
+
+	var sent []struct {
+		MessageID int `json:"message_id"`
+	}
+	if err := n.upload(ctx, requestMediaGroup, fields, parts, &sent); err != nil {
+		return "", err
+	}
+	if len(sent) == 0 {
+		return "", nil
+	}
+	return strconv.Itoa(sent[0].MessageID), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// upload calls the method with a multipart/form-data body.
+func (n *Notificator) upload(ctx context.Context, method string, fields map[string]string, files map[string]file, v interface{}) error {
+	buf := new(bytes.Buffer)
+	w := multipart.NewWriter(buf)
+	for key, value := range fields {
+		if err := w.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+	for field, f := range files {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(field), quoteEscaper.Replace(f.name)))
+		h.Set("Content-Type", f.contentType)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(f.content); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return n.call(ctx, method, buf, w.FormDataContentType(), v)
+}
@@ -0,0 +1,198 @@
+package telegram
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	messageLimit = 4096
+	documentName = "message.txt"
+)
+
+type token struct {
+	text string
+	tag  string // tag name, empty for text and entities
+	end  bool   // closing tag
+}
+
+// tokenize splits the HTML text into tags, entities and single characters.
+func tokenize(text string) []token {
+	var tokens []token
+	for len(text) > 0 {
+		switch text[0] {
+		case '<':
+			if t, ok := parseTag(text); ok {
+				tokens = append(tokens, t)
+				text = text[len(t.text):]
+				continue
+			}
+		case '&':
+			if i := strings.IndexByte(text, ';'); i > 1 && i < 12 && !strings.ContainsAny(text[1:i], " &<") {
+				tokens = append(tokens, token{text: text[:i+1]})
+				text = text[i+1:]
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(text)
+		tokens = append(tokens, token{text: text[:size]})
+		text = text[size:]
+	}
+	return tokens
+}
+
+func parseTag(text string) (token, bool) {
+	i := strings.IndexByte(text, '>')
+	if i < 2 {
+		return token{}, false
+	}
+	t := token{text: text[:i+1]}
+	name := text[1:i]
+	if strings.HasPrefix(name, "/") {
+		t.end = true
+		name = name[1:]
+	}
+	if j := strings.IndexAny(name, " \t\n"); j >= 0 {
+		name = name[:j]
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return token{}, false
+		}
+	}
+	if name == "" {
+		return token{}, false
+	}
+	t.tag = strings.ToLower(name)
+	return t, true
+}
+
+// length counts the text in UTF-16 code units as Telegram does;
+// tags are counted too, so the limit is never exceeded.
+func length(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r > 0xFFFF {
+			n++ // surrogate pair
+		}
+	}
+	return n
+}
+
+// apply returns the stack of the open tags after the token.
+func apply(stack []token, t token) []token {
+	if t.tag == "" {
+		return stack
+	}
+	if !t.end {
+		return append(stack[:len(stack):len(stack)], t)
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].tag == t.tag {
+			return stack[:i:i]
+		}
+	}
+	return stack
+}
+
+func openers(stack []token) string {
+	var b strings.Builder
+	for _, t := range stack {
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+func closers(stack []token) string {
+	var b strings.Builder
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteString("</" + stack[i].tag + ">")
+	}
+	return b.String()
+}
+
+// splitHTML splits the text into parts no longer than limit, preferring
+// paragraph, then line, then word boundaries. Tags open at a split are
+// closed at the end of the part and reopened in the next one; tags and
+// entities are never cut.
+func splitHTML(text string, limit int) []string {
+	if length(text) <= limit {
+		return []string{text}
+	}
+	tokens := tokenize(text)
+	var (
+		parts []string
+		stack []token
+	)
+	for start := 0; start < len(tokens); {
+		end, endStack := pack(tokens, start, stack, limit)
+		var b strings.Builder
+		b.WriteString(openers(stack))
+		for _, t := range tokens[start:end] {
+			b.WriteString(t.text)
+		}
+		b.WriteString(closers(endStack))
+		if part := strings.TrimSpace(b.String()); part != "" && part != openers(stack)+closers(endStack) {
+			parts = append(parts, part)
+		}
+		stack, start = endStack, end
+		for start < len(tokens) && strings.TrimSpace(tokens[start].text) == "" {
+			start++
+		}
+	}
+	return parts
+}
+
+// pack finds where to end the part beginning at start and the tags open there.
+func pack(tokens []token, start int, stack []token, limit int) (int, []token) {
+	type cut struct {
+		at       int
+		stack    []token
+		priority int
+		size     int
+	}
+	var best *cut
+	size := length(openers(stack))
+	for i := start; i < len(tokens); i++ {
+		t := tokens[i]
+		if i > start {
+			priority := -1
+			switch t.text {
+			case "\n":
+				priority = 1
+				if tokens[i-1].text == "\n" || i+1 < len(tokens) && tokens[i+1].text == "\n" {
+					priority = 2
+				}
+			case " ", "\t":
+				priority = 0
+			}
+			// a better boundary is kept unless it leaves the part too short
+			if priority >= 0 && (best == nil || priority >= best.priority || best.size < limit/2) {
+				best = &cut{at: i, stack: stack, priority: priority, size: size}
+			}
+		}
+		next := apply(stack, t)
+		if i > start && size+length(t.text)+length(closers(next)) > limit {
+			if best != nil {
+				return best.at, best.stack
+			}
+			return i, stack
+		}
+		size += length(t.text)
+		stack = next
+	}
+	return len(tokens), stack
+}
+
+// plainText strips the tags and decodes the entities of the HTML text.
+func plainText(text string) string {
+	var b strings.Builder
+	for _, t := range tokenize(text) {
+		if t.tag == "" {
+			b.WriteString(t.text)
+		}
+	}
+	return html.UnescapeString(b.String())
+}
@@ -2,16 +2,25 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"encoding/json"
 	"errors"
 	"fmt"
 
 	"redits.oculeus.com/asorokin/notification"
+	"redits.oculeus.com/asorokin/notification/ratelimit"
+	"redits.oculeus.com/asorokin/notification/render"
+	"redits.oculeus.com/asorokin/notification/tracing"
 	"redits.oculeus.com/asorokin/request"
 )
 
@@ -20,12 +29,29 @@ const (
 	requestMessage   = "sendMessage"
 )
 
+const Name = "telegram"
+
+func init() {
+	notification.Register(Name, func(decode func(interface{}) error, opts ...notification.Option) (notification.Notificator, error) {
+		cfg := &Config{}
+		if err := decode(cfg); err != nil {
+			return nil, err
+		}
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		return New(cfg, opts...), nil
+	})
+}
+
 type Notificator struct {
-	cfg *Config
+	cfg     *Config
+	limiter *ratelimit.Limiter
+	log     *slog.Logger
 }
 
 func (n *Notificator) String() string {
-	return "telegram"
+	return Name
 }
 
 type Config struct {
@@ -33,14 +59,62 @@ type Config struct {
 	Host    string        `cfg:"host"`
 	Token   string        `cfg:"token"`
 	Timeout time.Duration `cfg:"timeout"`
+	// MaxParts is the number of messages a long text may be split into,
+	// a longer text is sent as a document; 0 means no limit.
+	MaxParts int `cfg:"max_parts"`
+	// RateLimit limits the requests to the Bot API, the address limit is per chat.
+	RateLimit ratelimit.Config `cfg:"rate_limit"`
 	// Addresses []int         `cfg:"addresses"`
 }
 
-func New(cfg *Config) *Notificator {
+func (c *Config) Validate() error {
+	var missing []string
+	if c.Host == "" {
+		missing = append(missing, "host")
+	}
+	if c.Token == "" {
+		missing = append(missing, "token")
+	}
+	return notification.MissingFields(Name, missing...)
+}
+
+func New(cfg *Config, opts ...notification.Option) *Notificator {
 	if cfg.Proto == "" {
 		cfg.Proto = telegramProtocol
 	}
-	return &Notificator{cfg}
+	o := notification.NewOptions(opts...)
+	return &Notificator{
+		cfg:     cfg,
+		limiter: ratelimit.NewLimiter(cfg.RateLimit),
+		log:     o.Logger.With(notification.LogChannel, Name),
+	}
+}
+
+// redact hides the token in the URLs of the HTTP client errors.
+func (n *Notificator) redact(err error) string {
+	return notification.Redact(err.Error(), n.cfg.Token)
+}
+
+// APIError is an error returned by the Bot API.
+type APIError struct {
+	Code        int
+	Description string
+	retryAfter  time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("error:%d: %s", e.Code, e.Description)
+}
+
+// Temporary reports whether the request may succeed later:
+// too many requests or a server error.
+func (e *APIError) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// RetryAfter is the delay asked by the server with parameters.retry_after.
+func (e *APIError) RetryAfter() time.Duration {
+	return e.retryAfter
 }
 
 func (n *Notificator) requestPath(request string) string {
@@ -48,62 +122,218 @@ func (n *Notificator) requestPath(request string) string {
 }
 
 func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
 
-	//TODO: implement attacments for telegram
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	res, err := n.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	ctx, span := tracing.Start(ctx, Name, Name+" send",
+		tracing.RecipientsKey.Int(len(message.Addresses)),
+		tracing.AttachmentsKey.Int(len(attachments)),
+	)
+	res, err := n.deliver(ctx, message, attachments...)
+	tracing.EndResult(span, res, err)
+	return res, err
+}
 
+func (n *Notificator) deliver(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
 	body, err := io.ReadAll(message.Content)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	files, err := readFiles(attachments)
+	if err != nil {
+		return nil, err
+	}
+	text := string(body)
+	if message.Format != notification.FormatDefault {
+		text = render.TelegramHTML(text, message.Format)
+	}
+	if len(message.Addresses) == 0 {
+		return nil, notification.ErrNoAddresses
 	}
+	// debug and info messages arrive without a sound
+	silent := message.Silent ||
+		message.Severity == notification.SeverityDebug || message.Severity == notification.SeverityInfo
+	res := &notification.Result{Channel: Name}
 	for _, chat := range message.Addresses {
 		chatid, err := strconv.Atoi(chat)
 		if err != nil {
-			return err
+			res.Add(chat, "", notification.NewSendError(Name, chat, "", notification.ErrInvalidAddress, err))
+			continue
 		}
-		reqBody := struct {
-			ChatId    int    `json:"chat_id"`
-			Text      string `json:"text"`
-			ParseMode string `json:"parse_mode"`
-		}{
-			ChatId:    chatid,
-			Text:      string(body),
-			ParseMode: "html",
+		var messageID string
+		if len(files) > 0 {
+			messageID, err = n.sendWithFiles(ctx, chatid, silent, text, files)
+		} else {
+			messageID, err = n.sendText(ctx, chatid, silent, text)
 		}
-		buf := new(bytes.Buffer)
-		if err := json.NewEncoder(buf).Encode(reqBody); err != nil {
-			return fmt.Errorf("encode body JSON: %w", err)
+		if err != nil {
+			n.log.WarnContext(ctx, "send failed", notification.LogAddress, chat, notification.LogError, n.redact(err))
+		} else {
+			n.log.DebugContext(ctx, "sent", notification.LogAddress, chat, notification.LogMessageID, messageID)
 		}
+		res.Add(chat, messageID, sendError(chat, err))
+	}
+	return res, nil
+}
 
-		res, err := request.Do(&request.Params{
-			URL: request.NewAddress(n.cfg.Proto, n.cfg.Host).
-				SetEndpoint(n.requestPath(requestMessage)),
-			Body: buf,
-			Header: map[string]string{
-				"Content-Type": "application/json",
-			},
-			Client: &http.Client{
-				Timeout: n.cfg.Timeout,
-			},
-		})
+// sendError makes a *notification.SendError of the error sending to the chat.
+func sendError(chat string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var (
+		code   string
+		kind   error
+		apiErr *APIError
+	)
+	if errors.As(err, &apiErr) {
+		code = strconv.Itoa(apiErr.Code)
+		switch {
+		case apiErr.Code == http.StatusUnauthorized:
+			kind = notification.ErrUnauthorized
+		case apiErr.Code == http.StatusTooManyRequests:
+			kind = notification.ErrRateLimited
+		case apiErr.Code == http.StatusForbidden,
+			apiErr.Code == http.StatusBadRequest && strings.Contains(strings.ToLower(apiErr.Description), "chat not found"):
+			kind = notification.ErrInvalidAddress
+		}
+	}
+	return notification.NewSendError(Name, chat, code, kind, err)
+}
+
+// sendText sends the text split into several messages if it is too long,
+// or as a text document if it takes more than MaxParts messages.
+// It returns the id of the first message.
+func (n *Notificator) sendText(ctx context.Context, chatid int, silent bool, text string) (string, error) {
+	parts := splitHTML(text, messageLimit)
+	if n.cfg.MaxParts > 0 && len(parts) > n.cfg.MaxParts {
+		document := file{
+			name:        documentName,
+			contentType: "text/plain",
+			content:     []byte(plainText(text)),
+		}
+		return n.sendGroup(ctx, chatid, silent, splitHTML(text, captionLimit)[0], []file{document})
+	}
+	var firstID string
+	for _, part := range parts {
+		id, err := n.sendPart(ctx, chatid, silent, part)
 		if err != nil {
-			return err
+			return firstID, err
+		}
+		if firstID == "" {
+			firstID = id
 		}
-		defer res.Body.Close()
+	}
+	return firstID, nil
+}
+
+func (n *Notificator) sendPart(ctx context.Context, chatid int, silent bool, text string) (string, error) {
+	if err := n.limiter.Wait(ctx, strconv.Itoa(chatid)); err != nil {
+		return "", err
+	}
+	reqBody := struct {
+		ChatId              int    `json:"chat_id"`
+		Text                string `json:"text"`
+		ParseMode           string `json:"parse_mode"`
+		DisableNotification bool   `json:"disable_notification,omitempty"`
+	}{
+		ChatId:              chatid,
+		Text:                text,
+		ParseMode:           "html",
+		DisableNotification: silent,
+	}
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(reqBody); err != nil {
+		return "", fmt.Errorf("encode body JSON: %w", err)
+	}
+
+	var sent struct {
+		MessageID int `json:"message_id"`
+	}
+	if err := n.call(ctx, requestMessage, buf, "application/json", &sent); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(sent.MessageID), nil
+}
+
+// call posts the body to the bot API method and decodes the result into v.
+func (n *Notificator) call(ctx context.Context, method string, body io.Reader, contentType string, v interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, Name, Name+" "+method, attribute.String("telegram.method", method))
+	defer func() { tracing.End(span, err) }()
 
+	res, err := n.do(ctx,
+		request.NewAddress(n.cfg.Proto, n.cfg.Host).
+			SetEndpoint(n.requestPath(method)),
+		body,
+		contentType,
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var response struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		ErrorCode   int             `json:"error_code"`
+		Description string          `json:"description"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
 		if res.StatusCode != 200 {
-			var response struct {
-				OK          bool   `json:"ok"`
-				ErrorCode   int    `json:"error_code"`
-				Description string `json:"description"`
-			}
-			if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
-				return fmt.Errorf("decode json errResponse: %w", err)
-			}
-			if response.OK {
-				return fmt.Errorf("error:%d: %s", response.ErrorCode, response.Description)
+			return &APIError{
+				Code:        res.StatusCode,
+				Description: fmt.Sprintf("%s: decode json errResponse: %v", res.Status, err),
 			}
+		}
+		return fmt.Errorf("decode json response: %w", err)
+	}
+	n.log.DebugContext(ctx, "api response", "method", method, "status", res.StatusCode,
+		"ok", response.OK, "error_code", response.ErrorCode, "description", response.Description)
+	if !response.OK {
+		if response.ErrorCode == 0 {
 			return errors.New("unsupported telegram-api response")
 		}
+		return &APIError{
+			Code:        response.ErrorCode,
+			Description: response.Description,
+			retryAfter:  time.Duration(response.Parameters.RetryAfter) * time.Second,
+		}
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.Unmarshal(response.Result, v); err != nil {
+		return fmt.Errorf("decode json result: %w", err)
 	}
 	return nil
 }
+
+func (n *Notificator) do(ctx context.Context, url string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	client := &http.Client{
+		Timeout: n.cfg.Timeout,
+	}
+	res, err := client.Do(req)
+	// the error has the URL with the token
+	var urlErr *neturl.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = notification.Redact(urlErr.URL, n.cfg.Token)
+	}
+	return res, err
+}
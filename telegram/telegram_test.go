@@ -0,0 +1,233 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"redits.oculeus.com/asorokin/notification"
+	"redits.oculeus.com/asorokin/notification/tracing"
+)
+
+// testServer answers every bot API method with a sent message and
+// records the called methods.
+func testServer(t *testing.T) (*Notificator, *[]string) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		call := method
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Errorf("%s: %v", method, err)
+			}
+			call += ":" + r.FormValue("caption") + r.FormValue("media")
+		}
+		mu.Lock()
+		calls = append(calls, call)
+		mu.Unlock()
+		if method == requestMediaGroup {
+			fmt.Fprint(w, `{"ok":true,"result":[{"message_id":10},{"message_id":11}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":20}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return New(&Config{Proto: "http", Host: strings.TrimPrefix(srv.URL, "http://"), Token: "1:token"}), &calls
+}
+
+func TestNotificator_SendAttachments(t *testing.T) {
+	n, calls := testServer(t)
+	res, err := n.Send(context.Background(), notification.Message{
+		Addresses: []string{"123"},
+		Content:   strings.NewReader("report"),
+	},
+		notification.Attachment{Filename: "a.png", Content: strings.NewReader("png"), ContentType: "image/png"},
+		notification.Attachment{Filename: "b.jpg", Content: strings.NewReader("jpg")},
+		notification.Attachment{Filename: "report.csv", Content: strings.NewReader("a;b"), ContentType: "text/csv"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := res.Err(); err != nil || res.Deliveries[0].MessageID != "10" {
+		t.Errorf("Send() = %+v", res.Deliveries)
+	}
+	want := []string{
+		`sendMediaGroup:[{"type":"photo","media":"attach://file0","caption":"report","parse_mode":"html"},{"type":"photo","media":"attach://file1"}]`,
+		"sendDocument:",
+	}
+	if strings.Join(*calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls = %q, want %q", *calls, want)
+	}
+}
+
+func Test_splitHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{
+			name:  "Короткое сообщение",
+			text:  "<b>ERROR</b> relation does not exist",
+			limit: 100,
+			want:  []string{"<b>ERROR</b> relation does not exist"},
+		},
+		{
+			name:  "Разбиение по абзацам",
+			text:  "first line\nsecond line\n\nthird line",
+			limit: 25,
+			want:  []string{"first line\nsecond line", "third line"},
+		},
+		{
+			name:  "Разбиение по словам с переоткрытием тегов",
+			text:  "<pre>duplicate key value violates</pre>",
+			limit: 30,
+			want:  []string{"<pre>duplicate key value</pre>", "<pre>violates</pre>"},
+		},
+		{
+			name:  "Сущности не разрываются",
+			text:  "a&lt;&lt;&lt;&lt;",
+			limit: 10,
+			want:  []string{"a&lt;&lt;", "&lt;&lt;"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitHTML(tt.text, tt.limit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitHTML() = %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if length(part) > tt.limit {
+					t.Errorf("splitHTML() part %q longer than %d", part, tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func Test_plainText(t *testing.T) {
+	if got := plainText(`<b>key</b> &quot;tmp_over_carr_pkey&quot;`); got != `key "tmp_over_carr_pkey"` {
+		t.Errorf("plainText() = %q", got)
+	}
+}
+
+func TestNotificator_SendTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	n, _ := testServer(t)
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "caller")
+	_, err := n.Send(ctx, notification.Message{
+		Addresses: []string{"123", "chat"},
+		Content:   strings.NewReader("text"),
+	})
+	parent.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	send, call := spans["telegram send"], spans["telegram "+requestMessage]
+	if send == nil || call == nil {
+		t.Fatalf("spans = %v", spans)
+	}
+	if send.Parent().SpanID() != parent.SpanContext().SpanID() || call.Parent().SpanID() != send.SpanContext().SpanID() {
+		t.Errorf("spans are not nested: caller > send > %s", requestMessage)
+	}
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, a := range send.Attributes() {
+		attrs[a.Key] = a.Value
+	}
+	if attrs[tracing.RecipientsKey].AsInt64() != 2 || attrs[tracing.FailedKey].AsInt64() != 1 ||
+		len(attrs[tracing.MessageIDKey].AsStringSlice()) != 1 || send.Status().Code != codes.Error {
+		t.Errorf("send span attributes = %v, status = %v", attrs, send.Status())
+	}
+}
+
+func TestNotificator_SendLogging(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	host := strings.TrimPrefix(srv.URL, "http://")
+	srv.Close() // the connection is refused
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	n := New(&Config{Proto: "http", Host: host, Token: "1:secret"}, notification.WithLogger(logger))
+	err := n.SendMessage(notification.Message{
+		Addresses: []string{"123"},
+		Content:   strings.NewReader("text"),
+	})
+	if err == nil {
+		t.Fatal("SendMessage() error = nil")
+	}
+	if strings.Contains(err.Error(), "secret") || strings.Contains(buf.String(), "secret") {
+		t.Errorf("the token is not redacted:\n%v\n%s", err, buf.String())
+	}
+	if log := buf.String(); !strings.Contains(log, "send failed") || !strings.Contains(log, "channel=telegram address=123") {
+		t.Errorf("log = %s", log)
+	}
+}
+
+func TestNotificator_SendSilent(t *testing.T) {
+	tests := []struct {
+		name     string
+		severity notification.Severity
+		want     bool
+	}{
+		{name: "Без уровня", severity: notification.SeverityDefault, want: false},
+		{name: "Информация без звука", severity: notification.SeverityInfo, want: true},
+		{name: "Критическое со звуком", severity: notification.SeverityCritical, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					DisableNotification bool `json:"disable_notification"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Error(err)
+				}
+				got = body.DisableNotification
+				fmt.Fprint(w, `{"ok":true,"result":{"message_id":20}}`)
+			}))
+			defer srv.Close()
+
+			n := New(&Config{Proto: "http", Host: strings.TrimPrefix(srv.URL, "http://"), Token: "1:token"})
+			err := n.SendMessage(notification.Message{
+				Addresses: []string{"123"},
+				Content:   strings.NewReader("disk is 80% full"),
+				Severity:  tt.severity,
+			})
+			if err != nil {
+				t.Fatalf("SendMessage() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("disable_notification = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
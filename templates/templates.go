@@ -0,0 +1,182 @@
+package templates
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+const (
+	subjectVariant = "subject"
+	defaultVariant = "default"
+)
+
+var formats = map[string]notification.Format{
+	".html": notification.FormatHTML,
+	".md":   notification.FormatMarkdown,
+	".bb":   notification.FormatBBCode,
+	".txt":  notification.FormatPlain,
+	".tmpl": notification.FormatPlain,
+}
+
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+type variant struct {
+	tmpl   executor
+	format notification.Format
+}
+
+// Registry holds the named templates. Every directory with template files
+// is a template named by its path, the files are its variants:
+//
+//	alert/subject.tmpl   the subject
+//	alert/email.html     the body for the channel, by its String()
+//	alert/telegram.html
+//	alert/bitrix.bb
+//	alert/default.md     the body for the other channels
+//
+// The extension sets the format of the body: .html is executed with
+// html/template, .md, .bb, .txt and .tmpl with text/template.
+type Registry struct {
+	templates map[string]map[string]variant
+}
+
+// LoadDir loads the templates from the directory.
+func LoadDir(dir string) (*Registry, error) {
+	return Load(os.DirFS(dir))
+}
+
+// Load loads the templates from the file system, e.g. an embed.FS
+// (use fs.Sub to skip its root directory).
+func Load(fsys fs.FS) (*Registry, error) {
+	r := &Registry{templates: make(map[string]map[string]variant)}
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := path.Ext(p)
+		format, ok := formats[ext]
+		if !ok {
+			return nil
+		}
+		src, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		var tmpl executor
+		if ext == ".html" {
+			tmpl, err = htmltemplate.New(p).Parse(string(src))
+		} else {
+			tmpl, err = texttemplate.New(p).Parse(string(src))
+		}
+		if err != nil {
+			return fmt.Errorf("parse template: %w", err)
+		}
+		name, base := path.Dir(p), strings.TrimSuffix(path.Base(p), ext)
+		if r.templates[name] == nil {
+			r.templates[name] = make(map[string]variant)
+		}
+		if _, dup := r.templates[name][base]; dup {
+			return fmt.Errorf("template %s: duplicate variant %s", name, base)
+		}
+		r.templates[name][base] = variant{tmpl, format}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Render executes the template for the channel with the data.
+// The subject is empty if the template has no subject variant.
+func (r *Registry) Render(name, channel string, data interface{}) (subject, body string, format notification.Format, err error) {
+	variants, ok := r.templates[name]
+	if !ok {
+		return "", "", "", fmt.Errorf("template %q not found", name)
+	}
+	v, ok := variants[channel]
+	if !ok {
+		v, ok = variants[defaultVariant]
+	}
+	if !ok {
+		return "", "", "", fmt.Errorf("template %q has no %s or %s variant", name, channel, defaultVariant)
+	}
+	buf := new(bytes.Buffer)
+	if err := v.tmpl.Execute(buf, data); err != nil {
+		return "", "", "", err
+	}
+	body, format = buf.String(), v.format
+
+	if s, ok := variants[subjectVariant]; ok {
+		buf.Reset()
+		if err := s.tmpl.Execute(buf, data); err != nil {
+			return "", "", "", err
+		}
+		subject = strings.TrimSpace(buf.String())
+	}
+	return subject, body, format, nil
+}
+
+// Notificator renders the message template for the channel of the
+// wrapped notificator; messages without a template are passed as is.
+type Notificator struct {
+	next     notification.Notificator
+	registry *Registry
+}
+
+func New(next notification.Notificator, registry *Registry) *Notificator {
+	return &Notificator{next, registry}
+}
+
+func (n *Notificator) String() string {
+	return n.next.String()
+}
+
+func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	message, err := n.render(message)
+	if err != nil {
+		return err
+	}
+	return n.next.SendMessageContext(ctx, message, attachments...)
+}
+
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	message, err := n.render(message)
+	if err != nil {
+		return nil, err
+	}
+	return notification.Send(ctx, n.next, message, attachments...)
+}
+
+func (n *Notificator) render(message notification.Message) (notification.Message, error) {
+	if message.Template == "" {
+		return message, nil
+	}
+	subject, body, format, err := n.registry.Render(message.Template, n.next.String(), message.Data)
+	if err != nil {
+		return message, err
+	}
+	if subject != "" {
+		message.Subject = subject
+	}
+	message.Content = strings.NewReader(body)
+	message.Format = format
+	message.Template, message.Data = "", nil
+	return message, nil
+}
@@ -0,0 +1,76 @@
+package templates
+
+import (
+	"testing"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+func TestRegistry_Render(t *testing.T) {
+	r, err := LoadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]string{
+		"Service": "ReporterWorker0",
+		"Level":   "error",
+		"Error":   `pq: relation "mtcarrierdbret.LpDestCountry" does not exist`,
+	}
+	tests := []struct {
+		name        string
+		template    string
+		channel     string
+		wantSubject string
+		wantBody    string
+		wantFormat  notification.Format
+		wantErr     bool
+	}{
+		{
+			name:        "Вариант для email экранируется",
+			template:    "alert",
+			channel:     "email",
+			wantSubject: "ReporterWorker0: error",
+			wantBody:    "<p>Service <b>ReporterWorker0</b> failed:</p>\n<pre>pq: relation &#34;mtcarrierdbret.LpDestCountry&#34; does not exist</pre>\n",
+			wantFormat:  notification.FormatHTML,
+		},
+		{
+			name:        "Вариант для битрикса",
+			template:    "alert",
+			channel:     "bitrix",
+			wantSubject: "ReporterWorker0: error",
+			wantBody:    "[B]ReporterWorker0[/B]\npq: relation \"mtcarrierdbret.LpDestCountry\" does not exist\n",
+			wantFormat:  notification.FormatBBCode,
+		},
+		{
+			name:       "Вариант по умолчанию",
+			template:   "report",
+			channel:    "telegram",
+			wantBody:   "**ReporterWorker0**: pq: relation \"mtcarrierdbret.LpDestCountry\" does not exist\n",
+			wantFormat: notification.FormatMarkdown,
+		},
+		{
+			name:     "Нет варианта для канала",
+			template: "alert",
+			channel:  "slack",
+			wantErr:  true,
+		},
+		{
+			name:     "Нет шаблона",
+			template: "digest",
+			channel:  "email",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, body, format, err := r.Render(tt.template, tt.channel, data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Registry.Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if subject != tt.wantSubject || body != tt.wantBody || format != tt.wantFormat {
+				t.Errorf("Registry.Render() = %q, %q, %q, want %q, %q, %q",
+					subject, body, format, tt.wantSubject, tt.wantBody, tt.wantFormat)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"redits.oculeus.com/asorokin/notification"
+)
+
+// InstrumentationName is the name of the tracer of the library.
+const InstrumentationName = "redits.oculeus.com/asorokin/notification"
+
+const (
+	ChannelKey     = attribute.Key("notification.channel")
+	RecipientsKey  = attribute.Key("notification.recipients")
+	MessageIDKey   = attribute.Key("notification.message_id")
+	FailedKey      = attribute.Key("notification.failed")
+	AttachmentsKey = attribute.Key("notification.attachments")
+)
+
+// Start starts a span of the channel with the global tracer provider,
+// a child of the span in ctx if any.
+func Start(ctx context.Context, channel, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, ChannelKey.String(channel))
+	return otel.Tracer(InstrumentationName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// EndResult records the message ids and the failed addresses of the result and ends the span.
+func EndResult(span trace.Span, res *notification.Result, err error) {
+	if err == nil && res != nil {
+		var ids []string
+		for _, d := range res.Deliveries {
+			if d.MessageID != "" {
+				ids = append(ids, d.MessageID)
+			}
+		}
+		if len(ids) > 0 {
+			span.SetAttributes(MessageIDKey.StringSlice(ids))
+		}
+		if failed := res.Failed(); len(failed) > 0 {
+			span.SetAttributes(FailedKey.Int(len(failed)))
+			err = res.Err()
+		}
+	}
+	End(span, err)
+}
+
+// Notificator traces the messages sent through the wrapped notificator,
+// e.g. a Dispatcher; the backends trace their sends and API calls themselves.
+type Notificator struct {
+	next notification.Notificator
+}
+
+func New(next notification.Notificator) *Notificator {
+	return &Notificator{next}
+}
+
+func (n *Notificator) String() string {
+	return n.next.String()
+}
+
+func (n *Notificator) SendMessage(message notification.Message, attachments ...notification.Attachment) error {
+	return n.SendMessageContext(context.Background(), message, attachments...)
+}
+
+func (n *Notificator) SendMessageContext(ctx context.Context, message notification.Message, attachments ...notification.Attachment) error {
+	res, err := n.Send(ctx, message, attachments...)
+	if err != nil {
+		return err
+	}
+	return res.Err()
+}
+
+func (n *Notificator) Send(ctx context.Context, message notification.Message, attachments ...notification.Attachment) (*notification.Result, error) {
+	ctx, span := Start(ctx, n.String(), n.String()+" send",
+		RecipientsKey.Int(len(message.Addresses)),
+		AttachmentsKey.Int(len(attachments)),
+	)
+	res, err := notification.Send(ctx, n.next, message, attachments...)
+	EndResult(span, res, err)
+	return res, err
+}